@@ -0,0 +1,88 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const migrationChecksumMismatch = "migration checksum mismatch"
+
+// ChecksumDrift applied migration which content has changed since it was executed
+type ChecksumDrift struct {
+	Id string
+	// Applied checksum stored when migration was executed
+	Applied string
+	// Current checksum of registered migration
+	Current string
+}
+
+// sha256 checksum of migration content, e.g. up and down sql, parts are separated with zero byte
+func checksumOf(parts ...[]byte) string {
+	h := sha256.New()
+	for i, part := range parts {
+		if i > 0 {
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// find applied migrations which checksum differs from the registered one.
+// Migrations without checksum and records executed without checksum are skipped.
+func (m *Migrator) getChecksumDrifts(executed []migration) []ChecksumDrift {
+	checksums := make(map[string]string, len(m.migrations))
+	for _, migration := range m.migrations {
+		checksums[migration.Id] = migration.Checksum
+	}
+
+	var drifts []ChecksumDrift
+	for _, record := range executed {
+		current, ok := checksums[record.Migration]
+		if !ok || current == "" || record.Checksum == "" || current == record.Checksum {
+			continue
+		}
+		drifts = append(drifts, ChecksumDrift{Id: record.Migration, Applied: record.Checksum, Current: current})
+	}
+	return drifts
+}
+
+// find applied migrations executed without checksum, e.g. before checksums were stored,
+// which registered migration has checksum
+func (m *Migrator) getMissingChecksums(executed []migration) []ChecksumDrift {
+	checksums := make(map[string]string, len(m.migrations))
+	for _, migration := range m.migrations {
+		checksums[migration.Id] = migration.Checksum
+	}
+
+	var missing []ChecksumDrift
+	for _, record := range executed {
+		current := checksums[record.Migration]
+		if record.Checksum != "" || current == "" {
+			continue
+		}
+		missing = append(missing, ChecksumDrift{Id: record.Migration, Current: current})
+	}
+	return missing
+}
+
+func (m *Migrator) Verify() error {
+	return m.VerifyContext(context.Background())
+}
+
+func (m *Migrator) VerifyContext(ctx context.Context) error {
+	executed, err := m.getExecutedMigrationList(ctx)
+	if err != nil {
+		return err
+	}
+
+	drifts := m.getChecksumDrifts(executed)
+	for _, drift := range drifts {
+		m.config.Logger.Warn(migrationChecksumMismatch, "id", drift.Id, "applied", drift.Applied, "current", drift.Current)
+	}
+	if len(drifts) > 0 {
+		return ErrChecksumMismatch{Drifts: drifts}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	migrator "github.com/vshapovalov/gorm-migrator"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// parse command options, positional arguments are returned
+func parseCommand(name string, args []string, register func(flags *flag.FlagSet)) ([]string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	if register != nil {
+		register(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return flags.Args(), nil
+}
+
+// parse command options and check that there are no positional arguments
+func parseCommandOptions(name string, args []string, register func(flags *flag.FlagSet)) error {
+	rest, err := parseCommand(name, args, register)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New(name + ": unexpected arguments " + fmt.Sprint(rest))
+	}
+	return nil
+}
+
+func runUp(opts options, args []string, _ io.Writer) error {
+	var step int
+	err := parseCommandOptions("up", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&step, "step", 0, "quantity of migrations to execute, all pending migrations if 0")
+	})
+	if err != nil {
+		return err
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	if step > 0 {
+		return m.RunStep(step)
+	}
+	return m.Run()
+}
+
+func runDown(opts options, args []string, _ io.Writer) error {
+	step := 1
+	err := parseCommandOptions("down", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&step, "step", step, "quantity of migrations to roll back")
+	})
+	if err != nil {
+		return err
+	}
+	if step < 1 {
+		return errors.New("down: step must be positive")
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.RollbackStep(step)
+}
+
+func runStatus(opts options, args []string, out io.Writer) error {
+	if err := parseCommandOptions("status", args, nil); err != nil {
+		return err
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tBATCH\tAPPLIED AT")
+	for _, migration := range status.Migrations {
+		if migration.Applied == nil {
+			fmt.Fprintln(w, migration.Id+"\t"+string(migration.State)+"\t\t")
+			continue
+		}
+		fmt.Fprintln(w, migration.Id+"\t"+string(migration.State)+"\t"+formatApplied(*migration.Applied))
+	}
+	for _, applied := range status.Unknown {
+		fmt.Fprintln(w, applied.Id+"\tunknown\t"+formatApplied(applied))
+	}
+	return w.Flush()
+}
+
+// batch and time columns of applied migration
+func formatApplied(applied migrator.AppliedMigration) string {
+	appliedAt := ""
+	if !applied.AppliedAt.IsZero() {
+		appliedAt = applied.AppliedAt.Format(time.RFC3339)
+	}
+	return strconv.Itoa(applied.Batch) + "\t" + appliedAt
+}
+
+func runPlan(opts options, args []string, out io.Writer) error {
+	var step int
+	var down bool
+	err := parseCommandOptions("plan", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&step, "step", 0, "quantity of migrations, all pending migrations or 1 migration with -down if 0")
+		flags.BoolVar(&down, "down", false, "show migrations that would be rolled back")
+	})
+	if err != nil {
+		return err
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+
+	var plan migrator.Plan
+	switch {
+	case down && step == 0:
+		plan, err = m.RollbackStepCheck(1)
+	case down:
+		plan, err = m.RollbackStepCheck(step)
+	case step > 0:
+		plan, err = m.RunStepCheck(step)
+	default:
+		plan, err = m.RunCheck()
+	}
+	if err != nil {
+		return err
+	}
+
+	if plan.Empty() {
+		_, err = fmt.Fprintln(out, "nothing to do")
+		return err
+	}
+	_, err = fmt.Fprint(out, plan.String())
+	return err
+}
+
+func runRedo(opts options, args []string, _ io.Writer) error {
+	step := 1
+	err := parseCommandOptions("redo", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&step, "step", step, "quantity of migrations to roll back and execute again")
+	})
+	if err != nil {
+		return err
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.Redo(step)
+}
+
+func runReset(opts options, args []string, _ io.Writer) error {
+	if err := parseCommandOptions("reset", args, nil); err != nil {
+		return err
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.Reset()
+}
+
+func runForce(opts options, args []string, _ io.Writer) error {
+	var pending bool
+	rest, err := parseCommand("force", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&pending, "pending", false, "mark migration as not executed")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("force: migration id is required")
+	}
+
+	m, err := opts.newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.Force(rest[0], !pending)
+}
+
+func runValidate(opts options, args []string, out io.Writer) error {
+	if err := parseCommandOptions("validate", args, nil); err != nil {
+		return err
+	}
+
+	migrations, err := opts.loadMigrations()
+	if err != nil {
+		return err
+	}
+	policy, err := opts.idPolicy()
+	if err != nil {
+		return err
+	}
+	if err = migrator.ValidateMigrations(migrations, policy); err != nil {
+		return err
+	}
+
+	// checksums of applied migrations are verified only when database is available
+	if opts.dsn != "" {
+		m, err := opts.newMigrator()
+		if err != nil {
+			return err
+		}
+		if err = m.Verify(); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(out, strconv.Itoa(len(migrations))+" migrations are valid")
+	return err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// config files that are used when -config option is not set
+var defaultConfigFiles = []string{"gorm-migrator.yaml", "gorm-migrator.yml", "gorm-migrator.toml"}
+
+// reference to environment variable in config value, e.g. ${DB_PASSWORD}
+var envReferenceRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// fileConfig configuration file with named environments, e.g. dev, staging and prod
+type fileConfig struct {
+	// DefaultEnv environment that is used when -env option is not set
+	DefaultEnv   string                 `yaml:"default_env" toml:"default_env"`
+	Environments map[string]environment `yaml:"environments" toml:"environments"`
+}
+
+// environment settings, string values may refer to environment variables as ${VAR},
+// $ that doesn't start a reference is kept as is, e.g. in password of DSN.
+// Options set in command line take precedence over environment settings.
+type environment struct {
+	Driver     string `yaml:"driver" toml:"driver"`
+	Dsn        string `yaml:"dsn" toml:"dsn"`
+	Dir        string `yaml:"dir" toml:"dir"`
+	Format     string `yaml:"format" toml:"format"`
+	Table      string `yaml:"table" toml:"table"`
+	AppVersion string `yaml:"app_version" toml:"app_version"`
+	// IdPattern regular expression that every migration id must match
+	IdPattern string `yaml:"id_pattern" toml:"id_pattern"`
+	// Template text/template file of migrations created by create command
+	Template   string `yaml:"template" toml:"template"`
+	Lock       bool   `yaml:"lock" toml:"lock"`
+	Atomic     bool   `yaml:"atomic" toml:"atomic"`
+	Compensate bool   `yaml:"compensate" toml:"compensate"`
+	// Protected environment refuses commands that roll back migrations or change their state
+	Protected bool `yaml:"protected" toml:"protected"`
+}
+
+// read yaml or toml config file, unknown keys are reported as errors
+func readConfig(file string) (fileConfig, error) {
+	var config fileConfig
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(content), &config)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = errors.New("unknown key " + meta.Undecoded()[0].String())
+		}
+	default:
+		return config, errors.New("config " + file + ": unknown format, use .yaml, .yml or .toml file")
+	}
+	if err != nil {
+		return config, errors.New("config " + file + ": " + err.Error())
+	}
+	return config, nil
+}
+
+// find config file, returns empty string if file is not set and default files don't exist
+func findConfig(file string) (string, error) {
+	if file != "" {
+		return file, nil
+	}
+	for _, name := range defaultConfigFiles {
+		_, err := os.Stat(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// get environment by name, default environment or the only one is used if name is empty
+func (c fileConfig) environment(name string) (string, environment, error) {
+	if name == "" {
+		name = c.DefaultEnv
+	}
+	if name == "" && len(c.Environments) == 1 {
+		for only := range c.Environments {
+			name = only
+		}
+	}
+	if name == "" {
+		return "", environment{}, errors.New("environment is required, available environments: " + strings.Join(c.names(), ", "))
+	}
+
+	env, ok := c.Environments[name]
+	if !ok {
+		return "", environment{}, errors.New("unknown environment " + name + ", available environments: " + strings.Join(c.names(), ", "))
+	}
+	env, err := env.expand()
+	if err != nil {
+		return "", environment{}, errors.New("environment " + name + ": " + err.Error())
+	}
+	return name, env, nil
+}
+
+func (c fileConfig) names() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// replace ${VAR} references to environment variables in string settings, undefined variable is an error
+func (e environment) expand() (environment, error) {
+	var missing []string
+	expand := func(value string) string {
+		return envReferenceRegexp.ReplaceAllStringFunc(value, func(reference string) string {
+			name := envReferenceRegexp.FindStringSubmatch(reference)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+	}
+
+	e.Driver = expand(e.Driver)
+	e.Dsn = expand(e.Dsn)
+	e.Dir = expand(e.Dir)
+	e.Format = expand(e.Format)
+	e.Table = expand(e.Table)
+	e.AppVersion = expand(e.AppVersion)
+	e.Template = expand(e.Template)
+	if len(missing) > 0 {
+		return e, errors.New("environment variables are not set: " + strings.Join(missing, ", "))
+	}
+	return e, nil
+}
+
+// fill options that are not set in command line with environment settings
+func (o *options) applyEnvironment(env environment, flags *flag.FlagSet) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	setString := func(name string, option *string, value string) {
+		if !set[name] && value != "" {
+			*option = value
+		}
+	}
+	setBool := func(name string, option *bool, value bool) {
+		if !set[name] && value {
+			*option = value
+		}
+	}
+
+	setString("driver", &o.driver, env.Driver)
+	setString("dsn", &o.dsn, env.Dsn)
+	setString("dir", &o.dir, env.Dir)
+	setString("format", &o.format, env.Format)
+	setString("table", &o.table, env.Table)
+	setString("app-version", &o.appVersion, env.AppVersion)
+	setString("id-pattern", &o.idPattern, env.IdPattern)
+	setString("template", &o.template, env.Template)
+	setBool("lock", &o.lock, env.Lock)
+	setBool("atomic", &o.atomic, env.Atomic)
+	setBool("compensate", &o.compensate, env.Compensate)
+	o.protected = env.Protected
+}
+
+// load config file and apply selected environment to options
+func (o *options) loadConfig(flags *flag.FlagSet) error {
+	file, err := findConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		if o.env != "" {
+			return errors.New("environment " + o.env + " is set, but config file is not found")
+		}
+		return nil
+	}
+
+	config, err := readConfig(file)
+	if err != nil {
+		return err
+	}
+	name, env, err := config.environment(o.env)
+	if err != nil {
+		return err
+	}
+	o.env = name
+	o.applyEnvironment(env, flags)
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testYamlConfig = `
+default_env: dev
+environments:
+  dev:
+    driver: sqlite
+    dsn: dev.db
+  prod:
+    driver: postgres
+    dsn: host=${DB_HOST} password=${DB_PASSWORD}
+    table: audit.migrations
+    dir: db/migrations
+    app_version: v1.2.0
+    lock: true
+    protected: true
+`
+
+const testTomlConfig = `
+[environments.staging]
+driver = "mysql"
+dsn = "app:${DB_PASSWORD}@tcp(db)/app"
+atomic = false
+compensate = true
+`
+
+// write config file to temporary directory
+func writeConfig(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+// parse global options as run does
+func parseOptions(t *testing.T, args ...string) (options, error) {
+	var opts options
+	flags := flag.NewFlagSet("gorm-migrator", flag.ContinueOnError)
+	opts.register(flags)
+	require.NoError(t, flags.Parse(args))
+	return opts, opts.loadConfig(flags)
+}
+
+func Test_loadConfig(t *testing.T) {
+
+	t.Setenv("DB_HOST", "db.internal")
+	t.Setenv("DB_PASSWORD", "secret")
+	yamlFile := writeConfig(t, "gorm-migrator.yaml", testYamlConfig)
+
+	// default environment
+	opts, err := parseOptions(t, "-config", yamlFile)
+	require.NoError(t, err)
+	require.Equal(t, "dev", opts.env)
+	require.Equal(t, "sqlite", opts.driver)
+	require.Equal(t, "dev.db", opts.dsn)
+	require.Equal(t, "migrations", opts.dir)
+	require.False(t, opts.protected)
+
+	opts, err = parseOptions(t, "-config", yamlFile, "-env", "prod")
+	require.NoError(t, err)
+	require.Equal(t, "host=db.internal password=secret", opts.dsn)
+	require.Equal(t, "audit.migrations", opts.table)
+	require.Equal(t, "db/migrations", opts.dir)
+	require.Equal(t, "v1.2.0", opts.appVersion)
+	require.True(t, opts.lock)
+	require.True(t, opts.protected)
+
+	// command line options take precedence
+	opts, err = parseOptions(t, "-config", yamlFile, "-env", "prod", "-dir", "other", "-lock=false")
+	require.NoError(t, err)
+	require.Equal(t, "other", opts.dir)
+	require.False(t, opts.lock)
+
+	_, err = parseOptions(t, "-config", yamlFile, "-env", "qa")
+	require.EqualError(t, err, "unknown environment qa, available environments: dev, prod")
+
+	// the only environment is used by default
+	tomlFile := writeConfig(t, "gorm-migrator.toml", testTomlConfig)
+	opts, err = parseOptions(t, "-config", tomlFile)
+	require.NoError(t, err)
+	require.Equal(t, "staging", opts.env)
+	require.Equal(t, "mysql", opts.driver)
+	require.Equal(t, "app:secret@tcp(db)/app", opts.dsn)
+	require.True(t, opts.compensate)
+
+	require.NoError(t, os.Unsetenv("DB_PASSWORD"))
+	_, err = parseOptions(t, "-config", tomlFile)
+	require.EqualError(t, err, "environment staging: environment variables are not set: DB_PASSWORD")
+
+	_, err = parseOptions(t, "-config", writeConfig(t, "typo.yaml", "environments:\n  dev:\n    dns: dev.db\n"))
+	require.ErrorContains(t, err, "field dns not found")
+
+	_, err = parseOptions(t, "-config", writeConfig(t, "typo.toml", "[environments.dev]\ndns = \"dev.db\"\n"))
+	require.ErrorContains(t, err, "unknown key environments.dev.dns")
+}
+
+func Test_environment_expand(t *testing.T) {
+
+	t.Setenv("DB_USER", "app")
+
+	// only ${VAR} is a reference, other $ are kept, e.g. in password
+	env, err := environment{Dsn: "${DB_USER}:pa$word@tcp(db)/app", Dir: "pa$$w0rd$", Table: "${}"}.expand()
+	require.NoError(t, err)
+	require.Equal(t, "app:pa$word@tcp(db)/app", env.Dsn)
+	require.Equal(t, "pa$$w0rd$", env.Dir)
+	require.Equal(t, "${}", env.Table)
+
+	_, err = environment{Dsn: "${DB_USER}:${DB_SECRET}@tcp(db)/app"}.expand()
+	require.EqualError(t, err, "environment variables are not set: DB_SECRET")
+}
+
+func Test_ProtectedEnvironment(t *testing.T) {
+
+	global := createTestEnvironment(t)
+	file := writeConfig(t, "gorm-migrator.yaml", "environments:\n  prod:\n    protected: true\n")
+	global = append(global, "-config", file)
+
+	_, err := runCommand(t, global, "up")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, global, "down")
+	require.EqualError(t, err, "environment prod is protected, down is not allowed")
+
+	_, err = runCommand(t, global, "reset")
+	require.EqualError(t, err, "environment prod is protected, reset is not allowed")
+}
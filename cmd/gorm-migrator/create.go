@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// layout of timestamp version of created migrations
+const versionLayout = "20060102150405"
+
+const defaultSqlTemplate = `-- {{.Id}} {{.Direction}}
+`
+
+const defaultGooseTemplate = `-- +goose Up
+
+-- +goose Down
+`
+
+const defaultGoTemplate = `package {{.Package}}
+
+import (
+	migrator "github.com/vshapovalov/gorm-migrator"
+	"gorm.io/gorm"
+)
+
+var {{.GoName}} = migrator.Migration{
+	Id: "{{.Id}}",
+	Migrate: func(tx *gorm.DB) error {
+		return nil
+	},
+	Rollback: func(tx *gorm.DB) error {
+		return nil
+	},
+}
+`
+
+// version prefix of existing migration files
+var versionPrefixRegexp = regexp.MustCompile(`^(\d+)_`)
+
+// file of created migration
+type newFile struct {
+	name      string
+	template  string
+	direction string
+}
+
+// templateData values available in migration templates
+type templateData struct {
+	Id      string
+	Version string
+	Name    string
+	// GoName identifier of go migration with version, so it is unique in the package,
+	// e.g. Migration20220314120000CreateUsersTable
+	GoName  string
+	Package string
+	// Direction up or down for sql files of migrations in sql and golang-migrate format, empty otherwise
+	Direction string
+}
+
+func runCreate(opts options, args []string, out io.Writer) error {
+	var goFile bool
+	var pkg string
+	tmpl := opts.template
+	rest, err := parseCommand("create", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&goFile, "go", false, "create go file with migration stub instead of sql files")
+		flags.StringVar(&pkg, "package", "", "package of go file, name of migrations directory by default")
+		flags.StringVar(&tmpl, "template", tmpl, "text/template file used instead of the default template")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("create: migration name is required")
+	}
+	name := normalizeName(rest[0])
+	if name == "" {
+		return errors.New("create: migration name must contain letters or digits")
+	}
+
+	if err = os.MkdirAll(opts.dir, 0755); err != nil {
+		return err
+	}
+	version, err := nextVersion(opts.dir, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = normalizeName(filepath.Base(absPath(opts.dir)))
+	}
+	policy, err := opts.idPolicy()
+	if err != nil {
+		return err
+	}
+	id := version + "_" + name
+	if policy != nil {
+		if err = policy(id); err != nil {
+			return errors.New("create: migration " + id + ": " + err.Error())
+		}
+	}
+
+	data := templateData{
+		Id:      id,
+		Version: version,
+		Name:    name,
+		GoName:  goName(version, name),
+		Package: pkg,
+	}
+
+	var files []newFile
+	switch {
+	case goFile:
+		files = []newFile{{name: data.Id + ".go", template: defaultGoTemplate}}
+	case opts.format == formatGoose:
+		files = []newFile{{name: data.Id + ".sql", template: defaultGooseTemplate}}
+	case opts.format == formatSql || opts.format == formatGolangMigrate:
+		files = []newFile{
+			{name: data.Id + ".up.sql", template: defaultSqlTemplate, direction: "up"},
+			{name: data.Id + ".down.sql", template: defaultSqlTemplate, direction: "down"},
+		}
+	default:
+		return errors.New("unknown migrations format " + opts.format)
+	}
+
+	if tmpl != "" {
+		content, err := os.ReadFile(tmpl)
+		if err != nil {
+			return err
+		}
+		for i := range files {
+			files[i].template = string(content)
+		}
+	}
+
+	for _, file := range files {
+		fileData := data
+		fileData.Direction = file.direction
+		content, err := renderTemplate(file.name, file.template, fileData)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(opts.dir, file.name)
+		if err = writeNewFile(path, content); err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintln(out, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render template, go code is formatted
+func renderTemplate(file, text string, data templateData) ([]byte, error) {
+	t, err := template.New(file).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err = t.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	if filepath.Ext(file) == ".go" {
+		if formatted, err := format.Source(b.Bytes()); err == nil {
+			return formatted, nil
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// write file that must not exist
+func writeNewFile(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// timestamp version that is later than versions of existing migrations of the directory.
+// Shorter versions, e.g. sequential 1, 2, 3, are always lower than timestamp.
+func nextVersion(dir string, now time.Time) (string, error) {
+	next := now.Truncate(time.Second)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		match := versionPrefixRegexp.FindStringSubmatch(entry.Name())
+		if match == nil || len(match[1]) < len(versionLayout) {
+			continue
+		}
+		existing, err := time.Parse(versionLayout, match[1])
+		if err != nil {
+			return "", errors.New("file " + entry.Name() + ": version " + match[1] + " is not a timestamp " + versionLayout)
+		}
+		if !existing.Before(next) {
+			next = existing.Add(time.Second)
+		}
+	}
+	return next.Format(versionLayout), nil
+}
+
+// convert name to lower case words separated with underscore
+func normalizeName(name string) string {
+	var b strings.Builder
+	separate := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if separate && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			separate = false
+			continue
+		}
+		separate = true
+	}
+	return b.String()
+}
+
+// identifier of go migration, version and normalized name in camel case,
+// migrations with the same name get different identifiers
+func goName(version, name string) string {
+	var b strings.Builder
+	b.WriteString("Migration" + version)
+	// name that starts with digit is separated from version
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		b.WriteString("_")
+	}
+	for _, word := range strings.Split(name, "_") {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// absolute path, path as is if it can't be resolved
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
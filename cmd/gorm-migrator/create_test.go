@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_nextVersion(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Date(2022, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	version, err := nextVersion(dir, now)
+	require.NoError(t, err)
+	require.Equal(t, "20220314120000", version)
+
+	// sequential versions are lower than timestamp
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5_create_users.up.sql"), nil, 0644))
+	version, err = nextVersion(dir, now)
+	require.NoError(t, err)
+	require.Equal(t, "20220314120000", version)
+
+	// migration created in the same second or by clock ahead of ours
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20220314120000_create_posts.up.sql"), nil, 0644))
+	version, err = nextVersion(dir, now)
+	require.NoError(t, err)
+	require.Equal(t, "20220314120001", version)
+
+	// the next version is a valid timestamp
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20220314125959_create_tags.up.sql"), nil, 0644))
+	version, err = nextVersion(dir, now)
+	require.NoError(t, err)
+	require.Equal(t, "20220314130000", version)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20229999999999_broken.up.sql"), nil, 0644))
+	_, err = nextVersion(dir, now)
+	require.EqualError(t, err, "file 20229999999999_broken.up.sql: version 20229999999999 is not a timestamp 20060102150405")
+}
+
+func Test_normalizeName(t *testing.T) {
+	require.Equal(t, "create_users_table", normalizeName("Create users-table!"))
+	require.Equal(t, "", normalizeName("--"))
+	require.Equal(t, "Migration20220314120000CreateUsersTable", goName("20220314120000", "create_users_table"))
+	require.Equal(t, "Migration20220314120000_2fa", goName("20220314120000", "2fa"))
+}
+
+func Test_Create(t *testing.T) {
+
+	dir := t.TempDir()
+	global := []string{"-dir", dir}
+
+	out, err := runCommand(t, global, "create", "Create users")
+	require.NoError(t, err)
+	files := strings.Fields(out)
+	require.Len(t, files, 2)
+	require.True(t, strings.HasSuffix(files[0], "_create_users.up.sql"))
+	require.True(t, strings.HasSuffix(files[1], "_create_users.down.sql"))
+	content, err := os.ReadFile(files[1])
+	require.NoError(t, err)
+	id := strings.TrimSuffix(filepath.Base(files[1]), ".down.sql")
+	require.Equal(t, "-- "+id+" down\n", string(content))
+
+	// the next migration is ordered after the previous one
+	out, err = runCommand(t, global, "create", "-go", "-package", "migrations", "create posts")
+	require.NoError(t, err)
+	file := strings.TrimSpace(out)
+	require.True(t, filepath.Base(file) > filepath.Base(files[0]))
+	content, err = os.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "package migrations\n")
+	id = strings.TrimSuffix(filepath.Base(file), ".go")
+	version := strings.SplitN(id, "_", 2)[0]
+	require.Contains(t, string(content), "var Migration"+version+"CreatePosts = migrator.Migration{\n\tId: \""+id+"\",")
+
+	// migration with the same name gets another identifier, so both compile in one package
+	out, err = runCommand(t, global, "create", "-go", "-package", "migrations", "create posts")
+	require.NoError(t, err)
+	content, err = os.ReadFile(strings.TrimSpace(out))
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "var Migration"+version+"CreatePosts ")
+
+	out, err = runCommand(t, append(global, "-format", "goose"), "create", "create tags")
+	require.NoError(t, err)
+	content, err = os.ReadFile(strings.TrimSpace(out))
+	require.NoError(t, err)
+	require.Equal(t, defaultGooseTemplate, string(content))
+
+	// custom template
+	template := filepath.Join(t.TempDir(), "migration.tmpl")
+	require.NoError(t, os.WriteFile(template, []byte("-- {{.Name}} {{.Direction}} {{.Version}}\n"), 0644))
+	var buf bytes.Buffer
+	err = run(append(global, "create", "-template", template, "create_labels"), &buf)
+	require.NoError(t, err)
+	file = strings.Fields(buf.String())[0]
+	content, err = os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "-- create_labels up "+strings.SplitN(filepath.Base(file), "_", 2)[0]+"\n", string(content))
+
+	_, err = runCommand(t, global, "create")
+	require.EqualError(t, err, "create: migration name is required")
+
+	// id must satisfy configured pattern, nothing is created otherwise
+	before, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	_, err = runCommand(t, append(global, "-id-pattern", `^\d{14}_create_[a-z_]+$`), "create", "drop users")
+	require.ErrorContains(t, err, "id does not match pattern")
+	after, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, after, len(before))
+}
@@ -0,0 +1,124 @@
+// Command gorm-migrator runs SQL migrations from a directory against MySQL, Postgres or SQLite database.
+//
+// Usage:
+//
+//	gorm-migrator -driver postgres -dsn "host=localhost user=app dbname=app" -dir migrations up
+//
+// Settings may be defined per environment in yaml or toml config file:
+//
+//	default_env: dev
+//	environments:
+//	  dev:
+//	    driver: sqlite
+//	    dsn: dev.db
+//	  prod:
+//	    driver: postgres
+//	    dsn: ${DATABASE_URL}
+//	    table: audit.migrations
+//	    dir: db/migrations
+//	    lock: true
+//	    protected: true
+//
+//	gorm-migrator -env prod status
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const usage = `Usage: gorm-migrator [options] <command> [command options]
+
+Commands:
+  up [-step N]            execute pending migrations, N migrations if step is set
+  down [-step N]          roll back N last executed migrations, 1 by default
+  status                  show state of every migration
+  plan [-step N] [-down]  show migrations that would be executed or rolled back
+  redo [-step N]          roll back and execute again N last executed migrations, 1 by default
+  reset                   roll back all executed migrations
+  force [-pending] <id>   mark migration as executed, or as not executed with -pending
+  validate                check migration files, and checksums of applied migrations if dsn is set
+  create [-go] [-package P] [-template F] <name>
+                          create timestamped migration files, or go file with migration stub with -go
+
+Commands down, redo, reset and force are refused in protected environment of config file.
+
+Options:
+`
+
+// command runs subcommand with its arguments
+type command func(opts options, args []string, out io.Writer) error
+
+// commands that roll back migrations or change their state
+var destructiveCommands = map[string]bool{"down": true, "redo": true, "reset": true, "force": true}
+
+var commands = map[string]command{
+	"up":       runUp,
+	"down":     runDown,
+	"status":   runStatus,
+	"plan":     runPlan,
+	"redo":     runRedo,
+	"reset":    runReset,
+	"force":    runForce,
+	"validate": runValidate,
+	"create":   runCreate,
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gorm-migrator: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+// parse global options and run the command
+func run(args []string, out io.Writer) error {
+	var opts options
+	flags := flag.NewFlagSet("gorm-migrator", flag.ContinueOnError)
+	opts.register(flags)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("command is required")
+	}
+
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		return errors.New("unknown command " + name + ", available commands: " + strings.Join(commandNames(), ", "))
+	}
+
+	if err = opts.loadConfig(flags); err != nil {
+		return err
+	}
+	if opts.protected && destructiveCommands[name] {
+		return errors.New("environment " + opts.env + " is protected, " + name + " is not allowed")
+	}
+	return cmd(opts, flags.Args()[1:], out)
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
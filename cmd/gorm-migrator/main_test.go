@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// create directory with sql migrations and sqlite database, returns global options
+func createTestEnvironment(t *testing.T) []string {
+	dir := t.TempDir()
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0755))
+
+	files := map[string]string{
+		"1_create_users.up.sql":   "create table users (id integer primary key, name text);\ninsert into users (name) values ('a;b');",
+		"1_create_users.down.sql": "drop table users;",
+		"2_create_posts.up.sql": "create table posts (id integer primary key, title text);\n" +
+			"create trigger posts_title after insert on posts begin update posts set title = 'a;b' where id = new.id; end;",
+		"2_create_posts.down.sql": "drop table posts;",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), 0644))
+	}
+
+	return []string{"-driver", "sqlite", "-dsn", filepath.Join(dir, "test.db"), "-dir", migrationsDir}
+}
+
+// run command and get its output
+func runCommand(t *testing.T, global []string, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(append(append([]string{}, global...), args...), &out)
+	return out.String(), err
+}
+
+func Test_Commands(t *testing.T) {
+
+	global := createTestEnvironment(t)
+
+	out, err := runCommand(t, global, "plan")
+	require.NoError(t, err)
+	require.Equal(t, "up 1_create_users (not executed yet)\nup 2_create_posts (not executed yet)\n", out)
+
+	_, err = runCommand(t, global, "up", "-step", "1")
+	require.NoError(t, err)
+	_, err = runCommand(t, global, "up")
+	require.NoError(t, err)
+
+	out, err = runCommand(t, global, "plan")
+	require.NoError(t, err)
+	require.Equal(t, "nothing to do\n", out)
+
+	out, err = runCommand(t, global, "plan", "-down")
+	require.NoError(t, err)
+	require.Equal(t, "down 2_create_posts (executed in batch 2)\n", out)
+
+	out, err = runCommand(t, global, "status")
+	require.NoError(t, err)
+	require.Contains(t, out, "1_create_users  applied  1")
+	require.Contains(t, out, "2_create_posts  applied  2")
+
+	_, err = runCommand(t, global, "redo")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, global, "down", "-step", "1")
+	require.NoError(t, err)
+	out, err = runCommand(t, global, "status")
+	require.NoError(t, err)
+	require.Contains(t, out, "2_create_posts  pending")
+
+	_, err = runCommand(t, global, "force", "2_create_posts")
+	require.NoError(t, err)
+	_, err = runCommand(t, global, "force", "-pending", "2_create_posts")
+	require.NoError(t, err)
+
+	out, err = runCommand(t, global, "validate")
+	require.NoError(t, err)
+	require.Equal(t, "2 migrations are valid\n", out)
+
+	_, err = runCommand(t, global, "reset")
+	require.NoError(t, err)
+	out, err = runCommand(t, global, "status")
+	require.NoError(t, err)
+	require.Contains(t, out, "1_create_users  pending")
+
+	_, err = runCommand(t, global, "force")
+	require.EqualError(t, err, "force: migration id is required")
+
+	_, err = runCommand(t, global, "migrate")
+	require.EqualError(t, err, "unknown command migrate, available commands: create, down, force, plan, redo, reset, status, up, validate")
+}
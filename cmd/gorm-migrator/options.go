@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	migrator "github.com/vshapovalov/gorm-migrator"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"regexp"
+)
+
+const (
+	formatSql           = "sql"
+	formatGolangMigrate = "golang-migrate"
+	formatGoose         = "goose"
+)
+
+// options global command line options
+type options struct {
+	configFile string
+	env        string
+	driver     string
+	dsn        string
+	dir        string
+	format     string
+	table      string
+	appVersion string
+	idPattern  string
+	template   string
+	lock       bool
+	atomic     bool
+	compensate bool
+	debug      bool
+	// protected environment refuses commands that roll back migrations or change their state, set in config only
+	protected bool
+}
+
+func (o *options) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.configFile, "config", "", "yaml or toml config file with environments, gorm-migrator.yaml, gorm-migrator.yml or gorm-migrator.toml by default")
+	flags.StringVar(&o.env, "env", "", "environment of config file")
+	flags.StringVar(&o.driver, "driver", "", "database driver: mysql, postgres or sqlite")
+	flags.StringVar(&o.dsn, "dsn", "", "database connection string of the driver")
+	flags.StringVar(&o.dir, "dir", "migrations", "directory with migration files")
+	flags.StringVar(&o.format, "format", formatSql, "format of migration files: sql, golang-migrate or goose")
+	flags.StringVar(&o.table, "table", "", "table where executed migrations are stored, migrations by default")
+	flags.StringVar(&o.appVersion, "app-version", "", "application version stored along with executed migrations")
+	flags.StringVar(&o.idPattern, "id-pattern", "", "regular expression that every migration id must match")
+	flags.StringVar(&o.template, "template", "", "text/template file of migrations created by create command")
+	flags.BoolVar(&o.lock, "lock", false, "guard migrations from being executed by several processes at the same time")
+	flags.BoolVar(&o.atomic, "atomic", false, "execute all migrations of one run in a single transaction")
+	flags.BoolVar(&o.compensate, "compensate", false, "roll back migrations executed by the run when one of them fails")
+	flags.BoolVar(&o.debug, "debug", false, "log sql queries")
+}
+
+// load migrations from the directory according to the format
+func (o options) loadMigrations() ([]migrator.Migration, error) {
+	switch o.format {
+	case formatSql:
+		return migrator.LoadDir(o.dir)
+	case formatGolangMigrate:
+		return migrator.LoadGolangMigrateDir(o.dir)
+	case formatGoose:
+		return migrator.LoadGooseDir(o.dir)
+	default:
+		return nil, errors.New("unknown migrations format " + o.format)
+	}
+}
+
+// naming policy of migration ids, nil if pattern is not set
+func (o options) idPolicy() (migrator.IdPolicy, error) {
+	if o.idPattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(o.idPattern)
+	if err != nil {
+		return nil, errors.New("invalid id pattern: " + err.Error())
+	}
+	return migrator.IdPattern(pattern), nil
+}
+
+// open database with the driver
+func (o options) openDb() (*gorm.DB, error) {
+	if o.dsn == "" {
+		return nil, errors.New("dsn is required")
+	}
+
+	var dialector gorm.Dialector
+	switch o.driver {
+	case "mysql":
+		dialector = mysql.Open(o.dsn)
+	case "postgres":
+		dialector = postgres.Open(o.dsn)
+	case "sqlite":
+		dialector = sqlite.Open(o.dsn)
+	case "":
+		return nil, errors.New("driver is required")
+	default:
+		return nil, errors.New("unknown driver " + o.driver)
+	}
+
+	logLevel := logger.Silent
+	if o.debug {
+		logLevel = logger.Info
+	}
+	return gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logLevel)})
+}
+
+// create migrator for migrations of the directory
+func (o options) newMigrator() (*migrator.Migrator, error) {
+	migrations, err := o.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := o.idPolicy()
+	if err != nil {
+		return nil, err
+	}
+	db, err := o.openDb()
+	if err != nil {
+		return nil, err
+	}
+
+	config := migrator.Config{
+		Db:         db,
+		Table:      o.table,
+		Logger:     migrator.NewStdoutLogger(o.debug),
+		AppVersion: o.appVersion,
+		IdPolicy:   policy,
+		Atomic:     o.atomic,
+		Compensate: o.compensate,
+	}
+	if o.lock {
+		config.Locker = migrator.NewLocker(db, migrator.LockConfig{})
+	}
+	return migrator.NewMigrator(migrations, config)
+}
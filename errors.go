@@ -0,0 +1,165 @@
+package migrator
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrAtomicNotSupported returned when atomic mode is enabled for database without transactional DDL
+var ErrAtomicNotSupported = errors.New("atomic mode requires database with transactional DDL")
+
+// ErrLockTimeout returned when the migrations lock held by another process has not been released in time
+type ErrLockTimeout struct {
+	Name string
+}
+
+func (e ErrLockTimeout) Error() string {
+	return "migrations lock " + e.Name + " has not been acquired in time"
+}
+
+// ErrInterrupted returned when the context is done while migrations are executed or rolled back.
+// Id is the migration that was running or was about to run.
+type ErrInterrupted struct {
+	Id  string
+	Err error
+}
+
+func (e ErrInterrupted) Error() string {
+	return "migration " + e.Id + " interrupted: " + e.Err.Error()
+}
+
+func (e ErrInterrupted) Unwrap() error {
+	return e.Err
+}
+
+// ErrIrreversible returned when irreversible migration has to be rolled back, nothing is rolled back in this case
+type ErrIrreversible struct {
+	Id string
+}
+
+func (e ErrIrreversible) Error() string {
+	return "migration " + e.Id + " is irreversible"
+}
+
+// ErrDirty returned when migration has failed halfway and the database state is unknown.
+// Database has to be fixed by hand and migration state resolved with Force.
+type ErrDirty struct {
+	Id string
+}
+
+func (e ErrDirty) Error() string {
+	return "migration " + e.Id + " is dirty, fix the database and force migration state"
+}
+
+// ErrNotAtomic returned when migration that opts out of transaction has to be executed in atomic run
+type ErrNotAtomic struct {
+	Id string
+}
+
+func (e ErrNotAtomic) Error() string {
+	return "migration " + e.Id + " opts out of transaction and can't be executed in atomic run"
+}
+
+// ErrRunFailed returned in compensation mode when migration of a run fails.
+// Migrations executed by the run before the failed one are rolled back in reverse order.
+type ErrRunFailed struct {
+	// Id failed migration
+	Id string
+	// Err original failure
+	Err error
+	// RolledBack migrations that have been rolled back by compensation, in order of rolling back
+	RolledBack []string
+	// CompensationFailure failure that has stopped compensation, nil if all migrations have been rolled back
+	CompensationFailure *ErrCompensationFailed
+	// Dirty failed migration is left marked as dirty and is not compensated, because it has been executed
+	// without transaction or on database without transactional DDL and its changes may be applied partially.
+	// Migrations are not executed or rolled back until its state is resolved with Force
+	Dirty bool
+}
+
+func (e ErrRunFailed) Error() string {
+	msg := "migration " + e.Id + " failed: " + e.Err.Error()
+	if e.CompensationFailure != nil {
+		msg += "; " + e.CompensationFailure.Error()
+	}
+	if e.Dirty {
+		msg += "; migration " + e.Id + " is left dirty, resolve it with Force"
+	}
+	return msg
+}
+
+func (e ErrRunFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrCompensationFailed migration executed by the failed run can't be rolled back
+type ErrCompensationFailed struct {
+	Id  string
+	Err error
+}
+
+func (e ErrCompensationFailed) Error() string {
+	return "compensation of migration " + e.Id + " failed: " + e.Err.Error()
+}
+
+func (e ErrCompensationFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnknownMigration returned when migration with the id is not registered
+type ErrUnknownMigration struct {
+	Id string
+}
+
+func (e ErrUnknownMigration) Error() string {
+	return "migration " + e.Id + " is not registered"
+}
+
+// ErrInvalidTarget returned when migrations can't be executed or rolled back to the target migration
+type ErrInvalidTarget struct {
+	Id     string
+	Reason string
+}
+
+func (e ErrInvalidTarget) Error() string {
+	return "invalid target migration " + e.Id + ": " + e.Reason
+}
+
+// ErrInvalidMigrations returned when migrations registry is invalid, contains every found problem
+type ErrInvalidMigrations struct {
+	Problems []string
+}
+
+func (e ErrInvalidMigrations) Error() string {
+	return "invalid migrations: " + strings.Join(e.Problems, "; ")
+}
+
+// ErrStatement returned when statement of sql migration fails.
+// Index is the number of statement in the file starting from 1, Line is the line where statement starts.
+type ErrStatement struct {
+	Index int
+	Line  int
+	Err   error
+}
+
+func (e ErrStatement) Error() string {
+	return "statement #" + strconv.Itoa(e.Index) + " at line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+func (e ErrStatement) Unwrap() error {
+	return e.Err
+}
+
+// ErrChecksumMismatch returned when content of applied migrations has changed since they were executed
+type ErrChecksumMismatch struct {
+	Drifts []ChecksumDrift
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	ids := make([]string, 0, len(e.Drifts))
+	for _, drift := range e.Drifts {
+		ids = append(ids, drift.Id)
+	}
+	return "checksum mismatch of applied migrations: " + strings.Join(ids, ", ")
+}
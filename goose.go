@@ -0,0 +1,213 @@
+package migrator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	gooseAnnotationPrefix = "-- +goose"
+
+	gooseUp             = "Up"
+	gooseDown           = "Down"
+	gooseStatementBegin = "StatementBegin"
+	gooseStatementEnd   = "StatementEnd"
+	gooseNoTransaction  = "NO TRANSACTION"
+)
+
+// goose migration file name <version>_<name>.sql
+var gooseFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// statements of goose migration file
+type gooseMigration struct {
+	up            []sqlStatement
+	down          []sqlStatement
+	hasDown       bool
+	noTransaction bool
+}
+
+type gooseFile struct {
+	id      string
+	version string
+	file    string
+}
+
+// LoadGooseDir load goose sql migrations from the directory, see LoadGooseFS
+func LoadGooseDir(dir string) ([]Migration, error) {
+	return LoadGooseFS(os.DirFS(dir), ".")
+}
+
+// LoadGooseFS load migrations from goose <version>_<name>.sql files of the file system directory.
+// File is split into statements by -- +goose Up, -- +goose Down, -- +goose StatementBegin
+// and -- +goose StatementEnd annotations, each statement is executed separately.
+// Migration annotated with -- +goose NO TRANSACTION is not wrapped in transaction,
+// migration without -- +goose Down section is irreversible.
+// Migration id is <version>_<name>, migrations are sorted by numeric version.
+// Returns ErrInvalidMigrations listing files with invalid annotations, files with duplicated version
+// and sql files that don't follow naming convention.
+func LoadGooseFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	var files []gooseFile
+	byVersion := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := gooseFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			problems = append(problems, "file "+entry.Name()+": name does not match <version>_<name>.sql")
+			continue
+		}
+
+		// versions that differ only in leading zeros, e.g. 1 and 01, are the same version
+		version, id := match[1], strings.TrimSuffix(entry.Name(), ".sql")
+		if other, ok := byVersion[trimLeadingZeros(version)]; ok {
+			problems = append(problems, "file "+entry.Name()+": version "+version+" is used by migration "+other)
+			continue
+		}
+		byVersion[trimLeadingZeros(version)] = id
+		files = append(files, gooseFile{id: id, version: version, file: path.Join(dir, entry.Name())})
+	}
+	sortByVersion(files, func(file gooseFile) (string, string) {
+		return file.version, file.id
+	})
+
+	var migrations []Migration
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file.file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseGooseMigration(content)
+		if err != nil {
+			problems = append(problems, "migration "+file.id+": "+err.Error())
+			continue
+		}
+
+		migration := Migration{
+			Id:      file.id,
+			Migrate: makeHandlerFromStatements(parsed.up),
+			// file contains both up and down sql, so checksum covers both as for other sql migrations
+			Checksum:      checksumOf(content),
+			NoTransaction: parsed.noTransaction,
+		}
+		if parsed.hasDown {
+			migration.Rollback = makeHandlerFromStatements(parsed.down)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	if len(problems) > 0 {
+		return nil, ErrInvalidMigrations{Problems: problems}
+	}
+	return migrations, nil
+}
+
+// split goose migration into up and down statements.
+// Outside StatementBegin/StatementEnd block statement ends with line that ends with semicolon.
+func parseGooseMigration(content []byte) (gooseMigration, error) {
+	var parsed gooseMigration
+	var section *[]sqlStatement
+	var statement strings.Builder
+	inBlock := false
+	lineNumber, statementLine := 0, 0
+
+	flush := func() {
+		if sql := strings.TrimSpace(statement.String()); sql != "" {
+			*section = append(*section, sqlStatement{sql: sql, line: statementLine})
+		}
+		statement.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, gooseAnnotationPrefix) {
+			annotation := strings.TrimSpace(strings.TrimPrefix(trimmed, gooseAnnotationPrefix))
+			switch annotation {
+			case gooseUp, gooseDown:
+				if inBlock {
+					return parsed, gooseError(lineNumber, "StatementBegin is not closed before "+annotation)
+				}
+				if section != nil {
+					flush()
+				}
+				if annotation == gooseUp {
+					section = &parsed.up
+				} else {
+					section = &parsed.down
+					parsed.hasDown = true
+				}
+			case gooseStatementBegin:
+				if section == nil || inBlock {
+					return parsed, gooseError(lineNumber, "unexpected StatementBegin")
+				}
+				flush()
+				inBlock = true
+			case gooseStatementEnd:
+				if !inBlock {
+					return parsed, gooseError(lineNumber, "StatementEnd without StatementBegin")
+				}
+				flush()
+				inBlock = false
+			case gooseNoTransaction:
+				parsed.noTransaction = true
+			default:
+				return parsed, gooseError(lineNumber, "unknown annotation "+annotation)
+			}
+			continue
+		}
+
+		if section == nil {
+			// text before the first section, e.g. comments
+			continue
+		}
+		if !inBlock && statement.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		if statement.Len() == 0 {
+			statementLine = lineNumber
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return parsed, err
+	}
+
+	if section == nil {
+		return parsed, gooseError(0, "-- +goose Up annotation is missing")
+	}
+	if inBlock {
+		return parsed, gooseError(lineNumber, "StatementBegin is not closed")
+	}
+	flush()
+	return parsed, nil
+}
+
+// error of goose file parsing, line 0 means whole file
+func gooseError(line int, msg string) error {
+	if line == 0 {
+		return errors.New(msg)
+	}
+	return errors.New("line " + strconv.Itoa(line) + ": " + msg)
+}
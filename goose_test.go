@@ -0,0 +1,88 @@
+package migrator
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_parseGooseMigration(t *testing.T) {
+
+	content := `-- create users
+-- +goose Up
+create table users (
+    id int
+);
+insert into users values (1);
+
+-- +goose StatementBegin
+create function one() returns int as $$
+begin
+    return 1;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- drop everything
+drop function one;
+drop table users;
+`
+
+	parsed, err := parseGooseMigration([]byte(content))
+	require.NoError(t, err)
+	require.Equal(t, []sqlStatement{
+		{sql: "create table users (\n    id int\n);", line: 3},
+		{sql: "insert into users values (1);", line: 6},
+		{sql: "create function one() returns int as $$\nbegin\n    return 1;\nend;\n$$ language plpgsql;", line: 9},
+	}, parsed.up)
+	require.Equal(t, []sqlStatement{{sql: "drop function one;", line: 18}, {sql: "drop table users;", line: 19}}, parsed.down)
+	require.True(t, parsed.hasDown)
+	require.False(t, parsed.noTransaction)
+
+	parsed, err = parseGooseMigration([]byte("-- +goose NO TRANSACTION\n-- +goose Up\ncreate index concurrently idx on users (id);\n"))
+	require.NoError(t, err)
+	require.Equal(t, []sqlStatement{{sql: "create index concurrently idx on users (id);", line: 3}}, parsed.up)
+	require.False(t, parsed.hasDown)
+	require.True(t, parsed.noTransaction)
+
+	_, err = parseGooseMigration([]byte("create table users (id int);"))
+	require.EqualError(t, err, "-- +goose Up annotation is missing")
+
+	_, err = parseGooseMigration([]byte("-- +goose Up\n-- +goose StatementBegin\nselect 1;\n"))
+	require.EqualError(t, err, "line 3: StatementBegin is not closed")
+
+	_, err = parseGooseMigration([]byte("-- +goose Up\n-- +goose StatementEnd\n"))
+	require.EqualError(t, err, "line 2: StatementEnd without StatementBegin")
+}
+
+func Test_LoadGooseFS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"migrations/00010_create_posts.sql": {Data: []byte("-- +goose Up\ncreate table posts (id int);\n")},
+		"migrations/00002_create_users.sql": {Data: []byte("-- +goose Up\ncreate table users (id int);\n-- +goose Down\ndrop table users;\n")},
+		"migrations/00003_index.sql":        {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\ncreate index concurrently idx on users (id);\n")},
+	}
+
+	migrations, err := LoadGooseFS(fsys, "migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	require.Equal(t, "00002_create_users", migrations[0].Id)
+	require.True(t, migrations[0].IsReversible())
+	require.Equal(t, "00003_index", migrations[1].Id)
+	require.True(t, migrations[1].NoTransaction)
+	require.Equal(t, "00010_create_posts", migrations[2].Id)
+	require.False(t, migrations[2].IsReversible())
+
+	fsys["migrations/00004_broken.sql"] = &fstest.MapFile{Data: []byte("create table broken (id int);")}
+	fsys["migrations/seed.sql"] = &fstest.MapFile{Data: []byte("-- +goose Up\n")}
+	// same version as 00003_index
+	fsys["migrations/3_create_tags.sql"] = &fstest.MapFile{Data: []byte("-- +goose Up\ncreate table tags (id int);\n")}
+	_, err = LoadGooseFS(fsys, "migrations")
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Equal(t, []string{
+		"file 3_create_tags.sql: version 3 is used by migration 00003_index",
+		"file seed.sql: name does not match <version>_<name>.sql",
+		"migration 00004_broken: -- +goose Up annotation is missing",
+	}, err.(ErrInvalidMigrations).Problems)
+}
@@ -0,0 +1,183 @@
+package migrator
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+)
+
+// migration file name <version>_<name>.up.sql or <version>_<name>.down.sql
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w[\w\-]*)\.(up|down)\.sql$`)
+
+// golang-migrate file name, name may contain any characters
+var golangMigrateFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// pair of sql files of one migration
+type migrationFiles struct {
+	id      string
+	version string
+	up      string
+	down    string
+}
+
+// LoadDir load migrations from <version>_<name>.up.sql and <version>_<name>.down.sql files of the directory,
+// see LoadFS
+func LoadDir(dir string) ([]Migration, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS load migrations from <version>_<name>.up.sql and <version>_<name>.down.sql files
+// of the file system directory, e.g. embed.FS.
+// Migration id is <version>_<name>, migrations are sorted by numeric version.
+// Returns ErrInvalidMigrations listing files without pair, files with duplicated version
+// and sql files that don't follow naming convention.
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	list, problems, err := scanMigrationFiles(fsys, dir, migrationFileRegexp)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, files := range list {
+		if files.up == "" {
+			problems = append(problems, "migration "+files.id+": up file is missing")
+			continue
+		}
+		if files.down == "" {
+			problems = append(problems, "migration "+files.id+": down file is missing")
+			continue
+		}
+		migrations = append(migrations, NewFSMigration(fsys, files.id, files.up, files.down))
+	}
+
+	if len(problems) > 0 {
+		return nil, ErrInvalidMigrations{Problems: problems}
+	}
+	return migrations, nil
+}
+
+// LoadGolangMigrateDir load migrations from the directory in golang-migrate format,
+// see LoadGolangMigrateFS
+func LoadGolangMigrateDir(dir string) ([]Migration, error) {
+	return LoadGolangMigrateFS(os.DirFS(dir), ".")
+}
+
+// LoadGolangMigrateFS load migrations from <version>_<name>.up.sql and <version>_<name>.down.sql files
+// created for golang-migrate. Migration id is <version>_<name>, migrations are sorted by numeric version.
+// Down file is optional as in golang-migrate, migration without it is irreversible.
+// Returns ErrInvalidMigrations listing down files without up file, files with duplicated version
+// and sql files that don't follow naming convention.
+func LoadGolangMigrateFS(fsys fs.FS, dir string) ([]Migration, error) {
+	list, problems, err := scanMigrationFiles(fsys, dir, golangMigrateFileRegexp)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, files := range list {
+		if files.up == "" {
+			problems = append(problems, "migration "+files.id+": up file is missing")
+			continue
+		}
+		var down *sqlFile
+		if files.down != "" {
+			down = newSqlFile(fs.ReadFile(fsys, files.down))
+		}
+		migration := newSqlMigration(files.id, newSqlFile(fs.ReadFile(fsys, files.up)), down)
+		migrations = append(migrations, migration)
+	}
+
+	if len(problems) > 0 {
+		return nil, ErrInvalidMigrations{Problems: problems}
+	}
+	return migrations, nil
+}
+
+// find up and down files of migrations in the directory, files are sorted by version.
+// Pattern must capture version, name and direction.
+func scanMigrationFiles(fsys fs.FS, dir string, pattern *regexp.Regexp) ([]*migrationFiles, []string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problems []string
+	byId := make(map[string]*migrationFiles)
+	byVersion := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := pattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			problems = append(problems, "file "+entry.Name()+": name does not match <version>_<name>.up.sql or <version>_<name>.down.sql")
+			continue
+		}
+
+		// versions that differ only in leading zeros, e.g. 1 and 01, are the same version
+		version, id := match[1], match[1]+"_"+match[2]
+		if other, ok := byVersion[trimLeadingZeros(version)]; ok && other != id {
+			problems = append(problems, "file "+entry.Name()+": version "+version+" is used by migration "+other)
+			continue
+		}
+		byVersion[trimLeadingZeros(version)] = id
+
+		files, ok := byId[id]
+		if !ok {
+			files = &migrationFiles{id: id, version: version}
+			byId[id] = files
+		}
+		if match[3] == "up" {
+			files.up = path.Join(dir, entry.Name())
+		} else {
+			files.down = path.Join(dir, entry.Name())
+		}
+	}
+
+	list := make([]*migrationFiles, 0, len(byId))
+	for _, files := range byId {
+		list = append(list, files)
+	}
+	sortByVersion(list, func(files *migrationFiles) (string, string) {
+		return files.version, files.id
+	})
+
+	return list, problems, nil
+}
+
+// sort list by numeric version, id is compared when versions are equal, so the order doesn't depend on map iteration
+func sortByVersion[T any](list []T, key func(T) (version, id string)) {
+	sort.SliceStable(list, func(i, j int) bool {
+		versionI, idI := key(list[i])
+		versionJ, idJ := key(list[j])
+		if c := compareVersions(versionI, versionJ); c != 0 {
+			return c < 0
+		}
+		return idI < idJ
+	})
+}
+
+// compare numeric versions of any length
+func compareVersions(a, b string) int {
+	a, b = trimLeadingZeros(a), trimLeadingZeros(b)
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func trimLeadingZeros(version string) string {
+	for len(version) > 1 && version[0] == '0' {
+		version = version[1:]
+	}
+	return version
+}
@@ -0,0 +1,78 @@
+package migrator
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_LoadFS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"migrations/10_create_posts.up.sql":   {Data: []byte("create table posts (id int);")},
+		"migrations/10_create_posts.down.sql": {Data: []byte("drop table posts;")},
+		"migrations/2_create_users.up.sql":    {Data: []byte("create table users (id int);")},
+		"migrations/2_create_users.down.sql":  {Data: []byte("drop table users;")},
+		"migrations/README.md":                {Data: []byte("migrations")},
+	}
+
+	migrations, err := LoadFS(fsys, "migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, "2_create_users", migrations[0].Id)
+	require.Equal(t, "10_create_posts", migrations[1].Id)
+}
+
+func Test_LoadFS_Invalid(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"1_create_users.up.sql":     {Data: []byte("create table users (id int);")},
+		"2_create_posts.down.sql":   {Data: []byte("drop table posts;")},
+		"3_create_tags.up.sql":      {Data: []byte("create table tags (id int);")},
+		"3_create_tags.down.sql":    {Data: []byte("drop table tags;")},
+		"3_create_labels.up.sql":    {Data: []byte("create table labels (id int);")},
+		"create_comments.up.sql":    {Data: []byte("create table comments (id int);")},
+		"4_create_authors.up.sql":   {Data: []byte("create table authors (id int);")},
+		"4_create_authors.down.sql": {Data: []byte("drop table authors;")},
+		// same version as 4_create_authors
+		"04_create_books.up.sql":   {Data: []byte("create table books (id int);")},
+		"04_create_books.down.sql": {Data: []byte("drop table books;")},
+	}
+
+	_, err := LoadFS(fsys, ".")
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Equal(t, []string{
+		"file 3_create_tags.down.sql: version 3 is used by migration 3_create_labels",
+		"file 3_create_tags.up.sql: version 3 is used by migration 3_create_labels",
+		"file 4_create_authors.down.sql: version 4 is used by migration 04_create_books",
+		"file 4_create_authors.up.sql: version 4 is used by migration 04_create_books",
+		"file create_comments.up.sql: name does not match <version>_<name>.up.sql or <version>_<name>.down.sql",
+		"migration 1_create_users: down file is missing",
+		"migration 2_create_posts: up file is missing",
+		"migration 3_create_labels: down file is missing",
+	}, err.(ErrInvalidMigrations).Problems)
+}
+
+func Test_LoadGolangMigrateFS(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"1_create users.up.sql":   {Data: []byte("create table users (id int);")},
+		"1_create users.down.sql": {Data: []byte("drop table users;")},
+		"2_seed_users.up.sql":     {Data: []byte("insert into users values (1);")},
+		"3_create_posts.down.sql": {Data: []byte("drop table posts;")},
+	}
+
+	_, err := LoadGolangMigrateFS(fsys, ".")
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Equal(t, []string{"migration 3_create_posts: up file is missing"}, err.(ErrInvalidMigrations).Problems)
+
+	delete(fsys, "3_create_posts.down.sql")
+	migrations, err := LoadGolangMigrateFS(fsys, ".")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, "1_create users", migrations[0].Id)
+	require.True(t, migrations[0].IsReversible())
+	// down file is optional
+	require.Equal(t, "2_seed_users", migrations[1].Id)
+	require.False(t, migrations[1].IsReversible())
+}
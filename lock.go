@@ -0,0 +1,308 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLockName       = "gorm-migrator"
+	defaultLockTable      = "migrations_lock"
+	defaultLockTimeout    = time.Minute
+	defaultLockStaleAfter = time.Hour
+
+	// interval between attempts to acquire the lock for lockers that can't wait on the database side
+	lockRetryInterval = time.Second
+	// how long to wait for the lock to be released, unlock doesn't depend on the context of migrations
+	unlockTimeout = 10 * time.Second
+)
+
+// Locker guards migrations from being executed by several processes at the same time
+type Locker interface {
+	// Lock acquire the lock, wait while it is held by another process
+	Lock(ctx context.Context) error
+	// Unlock release the lock acquired by Lock
+	Unlock(ctx context.Context) error
+}
+
+// LockConfig locker configuration
+type LockConfig struct {
+	// Name of the lock, processes that use the same name exclude each other
+	Name string
+	// Timeout how long to wait for the lock held by another process
+	Timeout time.Duration
+	// StaleAfter lock held longer than this is considered abandoned and is taken over.
+	// Used by TableLocker only, database session locks are released when the holder disconnects.
+	StaleAfter time.Duration
+	// Table where TableLocker stores the lock
+	Table string
+}
+
+// fill empty configuration fields with defaults
+func (c LockConfig) withDefaults() LockConfig {
+	if c.Name == "" {
+		c.Name = defaultLockName
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultLockTimeout
+	}
+	if c.StaleAfter <= 0 {
+		c.StaleAfter = defaultLockStaleAfter
+	}
+	if c.Table == "" {
+		c.Table = defaultLockTable
+	}
+	return c
+}
+
+// NewLocker create locker suitable for the database dialect:
+// MySQL GET_LOCK, Postgres advisory lock, lock table for other databases
+func NewLocker(db *gorm.DB, config LockConfig) Locker {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return NewMysqlLocker(db, config)
+	case "postgres":
+		return NewPostgresLocker(db, config)
+	default:
+		return NewTableLocker(db, config)
+	}
+}
+
+// MysqlLocker uses MySQL named lock, lock is bound to the database connection
+type MysqlLocker struct {
+	db     *gorm.DB
+	config LockConfig
+	conn   *sql.Conn
+}
+
+func NewMysqlLocker(db *gorm.DB, config LockConfig) *MysqlLocker {
+	return &MysqlLocker{db: db, config: config.withDefaults()}
+}
+
+func (l *MysqlLocker) Lock(ctx context.Context) error {
+	conn, err := getConnection(ctx, l.db)
+	if err != nil {
+		return err
+	}
+
+	var acquired sql.NullInt64
+	err = conn.
+		QueryRowContext(ctx, "select get_lock(?, ?)", l.config.Name, int(l.config.Timeout.Seconds())).
+		Scan(&acquired)
+	if err != nil {
+		// lock state is unknown, the connection must not be reused
+		discardConnection(conn)
+		return err
+	}
+	if acquired.Int64 != 1 {
+		_ = conn.Close()
+		return ErrLockTimeout{Name: l.config.Name}
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *MysqlLocker) Unlock(ctx context.Context) (err error) {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.release(err)
+	}()
+
+	var released sql.NullInt64
+	return l.conn.QueryRowContext(ctx, "select release_lock(?)", l.config.Name).Scan(&released)
+}
+
+// close the connection that holds the lock, connection is discarded if the lock may still be held
+func (l *MysqlLocker) release(err error) {
+	if err != nil {
+		discardConnection(l.conn)
+	} else {
+		_ = l.conn.Close()
+	}
+	l.conn = nil
+}
+
+// PostgresLocker uses Postgres session advisory lock, lock is bound to the database connection
+type PostgresLocker struct {
+	db     *gorm.DB
+	config LockConfig
+	conn   *sql.Conn
+}
+
+func NewPostgresLocker(db *gorm.DB, config LockConfig) *PostgresLocker {
+	return &PostgresLocker{db: db, config: config.withDefaults()}
+}
+
+func (l *PostgresLocker) Lock(ctx context.Context) error {
+	conn, err := getConnection(ctx, l.db)
+	if err != nil {
+		return err
+	}
+
+	// pg_advisory_lock can't be limited in time, so try to acquire the lock until timeout
+	err = waitForLock(ctx, l.config, func() (bool, error) {
+		var acquired bool
+		err := conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", l.key()).Scan(&acquired)
+		return acquired, err
+	})
+	if err != nil {
+		// lock may be acquired by the query that has failed, the connection must not be reused
+		discardConnection(conn)
+		return err
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *PostgresLocker) Unlock(ctx context.Context) (err error) {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.release(err)
+	}()
+
+	var released bool
+	return l.conn.QueryRowContext(ctx, "select pg_advisory_unlock($1)", l.key()).Scan(&released)
+}
+
+// close the connection that holds the lock, connection is discarded if the lock may still be held
+func (l *PostgresLocker) release(err error) {
+	if err != nil {
+		discardConnection(l.conn)
+	} else {
+		_ = l.conn.Close()
+	}
+	l.conn = nil
+}
+
+// advisory lock key derived from the lock name
+func (l *PostgresLocker) key() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.config.Name))
+	return int64(h.Sum64())
+}
+
+// TableLocker stores the lock as a row in a table, works with any database.
+// Lock is not released when the holder dies, so lock older than StaleAfter is taken over.
+type TableLocker struct {
+	db     *gorm.DB
+	config LockConfig
+	owner  string
+}
+
+type lock struct {
+	Name       string    `gorm:"primaryKey;type:string;size:191;not null"`
+	Owner      string    `gorm:"type:string;size:191;not null"`
+	AcquiredAt time.Time `gorm:"not null"`
+}
+
+func NewTableLocker(db *gorm.DB, config LockConfig) *TableLocker {
+	host, _ := os.Hostname()
+	return &TableLocker{
+		db:     db,
+		config: config.withDefaults(),
+		owner:  host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+func (l *TableLocker) Lock(ctx context.Context) error {
+	db := l.db.WithContext(ctx)
+
+	err := db.Table(l.config.Table).AutoMigrate(lock{})
+	if err != nil {
+		return err
+	}
+
+	return waitForLock(ctx, l.config, func() (bool, error) {
+		err := l.insertLock(db)
+		if err == nil {
+			return true, nil
+		}
+
+		// insert fails because the lock is held by another process or because of database error
+		var held int64
+		countErr := db.Table(l.config.Table).Where("name = ?", l.config.Name).Count(&held).Error
+		if countErr != nil {
+			return false, countErr
+		}
+		if held == 0 {
+			// lock has been released after the insert failed, try again
+			return false, nil
+		}
+
+		// take over abandoned lock
+		res := db.Exec(
+			"delete from "+l.db.Statement.Quote(l.config.Table)+" where name = ? and acquired_at < ?",
+			l.config.Name,
+			time.Now().Add(-l.config.StaleAfter),
+		)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return false, res.Error
+		}
+		return l.insertLock(db) == nil, nil
+	})
+}
+
+// insert lock row, fails if the lock is held
+func (l *TableLocker) insertLock(db *gorm.DB) error {
+	return db.
+		Exec("insert into "+l.db.Statement.Quote(l.config.Table)+" (name, owner, acquired_at) values (?, ?, ?)", l.config.Name, l.owner, time.Now()).
+		Error
+}
+
+func (l *TableLocker) Unlock(ctx context.Context) error {
+	return l.db.
+		WithContext(ctx).
+		Exec("delete from "+l.db.Statement.Quote(l.config.Table)+" where name = ? and owner = ?", l.config.Name, l.owner).
+		Error
+}
+
+// get dedicated connection, session locks must be acquired and released on the same connection
+func getConnection(ctx context.Context, db *gorm.DB) (*sql.Conn, error) {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return sqlDb.Conn(ctx)
+}
+
+// close connection without returning it to the pool, session lock is released when the connection is closed
+func discardConnection(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
+
+// call try until it acquires the lock, returns error or lock timeout is reached
+func waitForLock(ctx context.Context, config LockConfig, try func() (bool, error)) error {
+	deadline := time.Now().Add(config.Timeout)
+	for {
+		acquired, err := try()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout{Name: config.Name}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
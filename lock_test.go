@@ -0,0 +1,181 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vshapovalov/gorm-migrator/mocks"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const testLockName = "test_lock"
+
+func Test_Migrator_Run_Lock(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      testMigrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+		Locker:     NewLocker(dbClient, LockConfig{Name: testLockName, Timeout: 5 * time.Second}),
+	})
+	require.NoError(t, err)
+
+	// migrations are executed while the lock is held
+	expectMysqlLock(sqlMock, 1)
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[3], migrations[4])
+	expectMysqlUnlock(sqlMock)
+	err = migrator.Run()
+	require.NoError(t, err)
+
+	// lock is held by another process
+	expectMysqlLock(sqlMock, 0)
+	err = migrator.Run()
+	require.ErrorAs(t, err, &ErrLockTimeout{})
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RunContext_Lock_Interrupted(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	locker := NewTableLocker(dbClient, LockConfig{Name: testLockName, Table: "lock_table"})
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      testMigrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+		Locker:     locker,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("CREATE TABLE `lock_table`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into `lock_table` (name, owner, acquired_at) values (?, ?, ?)")).
+		WithArgs(testLockName, locker.owner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// deploy timeout is reached right after migration 3 has been executed, the lock is released anyway
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2])
+	expectExecute(sqlMock, testMigrationTable, 2, migrations[3])
+	loggerMock.
+		On("Info", migrationExecuted, "id", migrations[3].Id).
+		Run(func(mock.Arguments) { cancel() })
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from `lock_table` where name = ? and owner = ?")).
+		WithArgs(testLockName, locker.owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = migrator.RunContext(ctx)
+	require.ErrorAs(t, err, &ErrInterrupted{})
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_TableLocker_StaleLock(t *testing.T) {
+
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+
+	locker := NewTableLocker(dbClient, LockConfig{Name: testLockName, Table: "lock_table", StaleAfter: time.Minute})
+
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("CREATE TABLE `lock_table`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// lock is held by another process
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into `lock_table` (name, owner, acquired_at) values (?, ?, ?)")).
+		WithArgs(testLockName, locker.owner, sqlmock.AnyArg()).
+		WillReturnError(errors.New("duplicate entry"))
+	sqlMock.
+		ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `lock_table` WHERE name = ?")).
+		WithArgs(testLockName).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// lock is abandoned and taken over
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from `lock_table` where name = ? and acquired_at < ?")).
+		WithArgs(testLockName, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into `lock_table` (name, owner, acquired_at) values (?, ?, ?)")).
+		WithArgs(testLockName, locker.owner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from `lock_table` where name = ? and owner = ?")).
+		WithArgs(testLockName, locker.owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = locker.Lock(context.Background())
+	require.NoError(t, err)
+	err = locker.Unlock(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_TableLocker_ReleasedLock(t *testing.T) {
+
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+
+	locker := NewTableLocker(dbClient, LockConfig{Name: testLockName, Table: "lock_table"})
+
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("CREATE TABLE `lock_table`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// lock is held by another process and released before it is counted
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into `lock_table` (name, owner, acquired_at) values (?, ?, ?)")).
+		WithArgs(testLockName, locker.owner, sqlmock.AnyArg()).
+		WillReturnError(errors.New("duplicate entry"))
+	sqlMock.
+		ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `lock_table` WHERE name = ?")).
+		WithArgs(testLockName).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// lock is acquired on the next attempt
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into `lock_table` (name, owner, acquired_at) values (?, ?, ?)")).
+		WithArgs(testLockName, locker.owner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = locker.Lock(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func expectMysqlLock(mock sqlmock.Sqlmock, acquired int) {
+	mock.
+		ExpectQuery(regexp.QuoteMeta("select get_lock(?, ?)")).
+		WithArgs(testLockName, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(acquired))
+}
+
+func expectMysqlUnlock(mock sqlmock.Sqlmock) {
+	mock.
+		ExpectQuery(regexp.QuoteMeta("select release_lock(?)")).
+		WithArgs(testLockName).
+		WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(1))
+}
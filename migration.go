@@ -2,6 +2,7 @@ package migrator
 
 import (
 	"gorm.io/gorm"
+	"io/fs"
 	"io/ioutil"
 )
 
@@ -13,25 +14,97 @@ type Migration struct {
 	Id       string
 	Migrate  MigrationHandler
 	Rollback MigrationHandler
+	// Checksum optional checksum of migration content, it is stored along with execution metadata.
+	// Checksum of sql migration covers both migrate and rollback sql, see Verify
+	Checksum string
+	// Irreversible migration can't be rolled back, migration without Rollback handler is irreversible as well
+	Irreversible bool
+	// NoTransaction migration handlers are not wrapped in transaction,
+	// e.g. for Postgres CREATE INDEX CONCURRENTLY which can't be executed inside transaction.
+	// Migration is marked as dirty in migrations table while handler is running.
+	NoTransaction bool
+
+	// error of reading migration files, reported by ValidateMigrations
+	loadErr error
+}
+
+// IsReversible check that migration can be rolled back
+func (m Migration) IsReversible() bool {
+	return !m.Irreversible && m.Rollback != nil
 }
 
 // NewFileMigration Create migration from files
-// Read files and run raw sql
+// Files are read when migration is created, checksum of both files is stored on execution.
+// Read error is reported by ValidateMigrations and returned by handler.
+// Run sql statements one by one, see ErrStatement
 func NewFileMigration(id, migrateFile, rollbackFile string) Migration {
-	return Migration{
-		Id:       id,
-		Migrate:  makeHandlerFromFile(migrateFile),
-		Rollback: makeHandlerFromFile(rollbackFile),
+	return newSqlMigration(id, newSqlFile(ioutil.ReadFile(migrateFile)), newSqlFile(ioutil.ReadFile(rollbackFile)))
+}
+
+// NewFSMigration Create migration from files of file system, e.g. embed.FS
+// Files are read when migration is created, checksum of both files is stored on execution.
+// Read error is reported by ValidateMigrations and returned by handler.
+// Run sql statements one by one, see ErrStatement
+func NewFSMigration(fsys fs.FS, id, migrateFile, rollbackFile string) Migration {
+	return newSqlMigration(id, newSqlFile(fs.ReadFile(fsys, migrateFile)), newSqlFile(fs.ReadFile(fsys, rollbackFile)))
+}
+
+// sqlFile content of migration file or error of reading it
+type sqlFile struct {
+	content []byte
+	err     error
+}
+
+func newSqlFile(content []byte, err error) *sqlFile {
+	return &sqlFile{content: content, err: err}
+}
+
+// create migration that runs sql of the files, migration without down file is irreversible.
+// Checksum covers content of both files.
+func newSqlMigration(id string, up, down *sqlFile) Migration {
+	migration := Migration{
+		Id:      id,
+		Migrate: makeHandlerFromContent(up.content, up.err),
+		loadErr: up.err,
 	}
+	parts := [][]byte{up.content}
+	if down != nil {
+		migration.Rollback = makeHandlerFromContent(down.content, down.err)
+		if migration.loadErr == nil {
+			migration.loadErr = down.err
+		}
+		parts = append(parts, down.content)
+	}
+	if migration.loadErr == nil {
+		migration.Checksum = checksumOf(parts...)
+	}
+	return migration
 }
 
-// Returns handle that read file and run raw sql
-func makeHandlerFromFile(file string) MigrationHandler {
+// Returns handle that split sql into statements with respect to database dialect
+// and run them one by one, or returns read error
+func makeHandlerFromContent(content []byte, err error) MigrationHandler {
 	return func(tx *gorm.DB) error {
-		readFile, err := ioutil.ReadFile(file)
 		if err != nil {
 			return err
 		}
-		return tx.Exec(string(readFile)).Error
+		return execStatements(tx, splitStatements(string(content), tx.Dialector.Name()))
+	}
+}
+
+// Returns handle that run statements one by one
+func makeHandlerFromStatements(statements []sqlStatement) MigrationHandler {
+	return func(tx *gorm.DB) error {
+		return execStatements(tx, statements)
+	}
+}
+
+// run statements one by one, stop at the first failed statement
+func execStatements(tx *gorm.DB, statements []sqlStatement) error {
+	for i, statement := range statements {
+		if err := tx.Exec(statement.sql).Error; err != nil {
+			return ErrStatement{Index: i + 1, Line: statement.line, Err: err}
+		}
 	}
+	return nil
 }
@@ -2,17 +2,21 @@ package migrator
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -77,8 +81,9 @@ func (s *SuiteMigration) Test_NewFileMigration() {
 
 	migration := NewFileMigration(migrationId, migrateFile, rollbackFile)
 
-	s.mock.ExpectExec(regexp.QuoteMeta(migrateFileContent)).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
-	s.mock.ExpectExec(regexp.QuoteMeta(rollbackFileContent)).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	// statements are executed without delimiter
+	s.mock.ExpectExec(regexp.QuoteMeta(strings.TrimSuffix(migrateFileContent, ";"))).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(strings.TrimSuffix(rollbackFileContent, ";"))).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
 
 	err = migration.Migrate(s.DB)
 	require.NoError(s.T(), err)
@@ -87,4 +92,72 @@ func (s *SuiteMigration) Test_NewFileMigration() {
 	require.NoError(s.T(), err)
 
 	require.Equal(s.T(), migrationId, migration.Id)
+	require.Equal(s.T(), checksumOf([]byte(migrateFileContent), []byte(rollbackFileContent)), migration.Checksum)
+}
+
+// check that method reads files from file system
+func (s *SuiteMigration) Test_NewFSMigration() {
+
+	migrateFileContent := "create table posts (`id` int);"
+	rollbackFileContent := "drop table posts;"
+	migrationId := "create_posts_table"
+
+	fsys := fstest.MapFS{
+		"migrations/migrate.sql":  {Data: []byte(migrateFileContent)},
+		"migrations/rollback.sql": {Data: []byte(rollbackFileContent)},
+	}
+
+	migration := NewFSMigration(fsys, migrationId, "migrations/migrate.sql", "migrations/rollback.sql")
+
+	// statements are executed without delimiter
+	s.mock.ExpectExec(regexp.QuoteMeta(strings.TrimSuffix(migrateFileContent, ";"))).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta(strings.TrimSuffix(rollbackFileContent, ";"))).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := migration.Migrate(s.DB)
+	require.NoError(s.T(), err)
+
+	err = migration.Rollback(s.DB)
+	require.NoError(s.T(), err)
+
+	require.Equal(s.T(), migrationId, migration.Id)
+
+	require.Len(s.T(), migration.Checksum, 64)
+
+	// checksum covers rollback file as well
+	edited := fstest.MapFS{
+		"migrations/migrate.sql":  {Data: []byte(migrateFileContent)},
+		"migrations/rollback.sql": {Data: []byte("drop table if exists posts;")},
+	}
+	require.NotEqual(s.T(), migration.Checksum, NewFSMigration(edited, migrationId, "migrations/migrate.sql", "migrations/rollback.sql").Checksum)
+
+	// missing file is reported by validation and when migration is executed
+	migration = NewFSMigration(fsys, migrationId, "migrations/missing.sql", "migrations/rollback.sql")
+	require.Equal(s.T(), "", migration.Checksum)
+	err = ValidateMigrations([]Migration{migration}, nil)
+	require.Equal(s.T(), ErrInvalidMigrations{Problems: []string{
+		"migration create_posts_table: open migrations/missing.sql: file does not exist",
+	}}, err)
+	err = migration.Migrate(s.DB)
+	require.ErrorIs(s.T(), err, fs.ErrNotExist)
+}
+
+// check that statements of the file are executed one by one and failed statement is reported
+func (s *SuiteMigration) Test_NewFSMigration_Statements() {
+
+	migrateFileContent := "-- users\ncreate table users (`id` int);\n\ninsert into users values (1);\ninsert into users values (2);\n"
+
+	fsys := fstest.MapFS{
+		"migrate.sql":  {Data: []byte(migrateFileContent)},
+		"rollback.sql": {Data: []byte("drop table users;")},
+	}
+
+	migration := NewFSMigration(fsys, "create_users_table", "migrate.sql", "rollback.sql")
+
+	dbErr := errors.New("duplicate entry")
+	s.mock.ExpectExec(regexp.QuoteMeta("create table users (`id` int)")).WithArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(regexp.QuoteMeta("insert into users values (1)")).WithArgs().WillReturnError(dbErr)
+
+	err := migration.Migrate(s.DB)
+	require.Equal(s.T(), ErrStatement{Index: 2, Line: 4, Err: dbErr}, err)
+	require.ErrorIs(s.T(), err, dbErr)
 }
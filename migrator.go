@@ -1,7 +1,12 @@
 package migrator
 
 import (
+	"context"
+	"database/sql"
 	"gorm.io/gorm"
+	"os"
+	"strings"
+	"time"
 )
 
 const (
@@ -12,30 +17,96 @@ const (
 	migrationRolledBack   = "migration rolled back"
 	migrationFailed       = "migration failed"
 	migrationExecuted     = "migration executed"
+	migrationOutOfOrder   = "migration executed out of declared order"
+	migrationForced       = "migration state forced"
+	atomicRunRolledBack   = "atomic run rolled back"
+	compensationFailed    = "compensation failed"
 )
 
-var defaultMigrationTableName = "migrations"
+const defaultMigrationTableName = "migrations"
+
+// how long compensation may take, compensation doesn't depend on the context of migrations
+const compensationTimeout = 10 * time.Minute
 
 // IMigrator manages migrations in the project
+// Migration that is executed without transaction, or on database without transactional DDL (e.g. MySQL),
+// stays dirty when it fails, methods that execute or roll back migrations return ErrDirty until it is resolved with Force.
 type IMigrator interface {
 	// Run execute all new migrations from current.
 	// Skip migrations that have been executed.
 	Run() error
-	// RunCheck show all new migrations from current.
+	// RunCheck plan all new migrations from current and log the plan.
 	// Skip migrations that have been executed.
-	RunCheck() error
+	RunCheck() (Plan, error)
 	// RunStep execute specified quantity of new migrations from current.
 	// For example, we have three new migrations, RunStep(2) will execute only first two of them from current.
 	RunStep(step int) error
-	// RunStepCheck show list of migrations that wil be executed.
-	// For example, we have three new migrations, RunStepCheck(2) will show only first two of them from current.
-	RunStepCheck(step int) error
+	// RunStepCheck plan list of migrations that wil be executed and log the plan.
+	// For example, we have three new migrations, RunStepCheck(2) will plan only first two of them from current.
+	RunStepCheck(step int) (Plan, error)
 	// RollbackStep execute specified quantity of migrations that wil be rolled back from current.
 	// For example, we have three executed migrations, RollbackStep(2) will roll back only two of them from current.
+	// Migrations are rolled back in reverse order of their execution, not in reverse order of declaration.
+	// Every rollback method returns ErrIrreversible before rolling anything back, if any of migrations is irreversible.
 	RollbackStep(step int) error
-	// RollbackStepCheck show list of migrations that wil be rolled back from current.
-	// For example, we have three executed migrations, RollbackStepCheck(2) will show only two of them from current.
-	RollbackStepCheck(step int) error
+	// RollbackStepCheck plan list of migrations that wil be rolled back from current and log the plan.
+	// For example, we have three executed migrations, RollbackStepCheck(2) will plan only two of them from current.
+	// Returns the plan along with ErrIrreversible if any planned migration is irreversible.
+	RollbackStepCheck(step int) (Plan, error)
+	// RollbackBatch roll back all migrations of the specified quantity of last batches.
+	// Every Run or RunStep call executes its migrations as one batch,
+	// so RollbackBatch(1) undoes everything the last Run has executed.
+	RollbackBatch(batches int) error
+	// RollbackLastBatch roll back all migrations of the last batch, same as RollbackBatch(1).
+	RollbackLastBatch() error
+	// RunTo execute new migrations up to and including the target migration in declared order.
+	// Returns ErrUnknownMigration if target is not registered.
+	RunTo(id string) error
+	// RollbackTo roll back all migrations that have been executed after the target migration,
+	// target migration itself stays executed.
+	// Returns ErrUnknownMigration if target is not registered and ErrInvalidTarget if it is not executed.
+	RollbackTo(id string) error
+	// Reset roll back all executed migrations.
+	Reset() error
+	// Refresh roll back all executed migrations and execute all migrations again.
+	Refresh() error
+	// Redo roll back specified quantity of last executed migrations and execute them again.
+	// For example, Redo(1) re-applies the migration that has been executed last.
+	Redo(step int) error
+	// Force set migration state after the database has been fixed by hand, e.g. after migration has failed halfway.
+	// Migration is marked as executed and not dirty if applied is true, otherwise it is removed from migrations table.
+	Force(id string, applied bool) error
+	// Status get state of every registered migration and list of applied migrations that are no longer registered
+	Status() (Status, error)
+	// Verify check that content of applied migrations has not changed since they were executed,
+	// returns ErrChecksumMismatch listing changed migrations
+	Verify() error
+	// Repair replace checksums of applied migrations that have been edited intentionally with the current ones,
+	// record checksums of applied migrations executed without checksum
+	// and delete records of applied migrations that are no longer registered.
+	// Nothing is changed if dryRun is true, returned report lists changes that would be made.
+	Repair(dryRun bool) (RepairReport, error)
+
+	// Context variants of the methods above.
+	// Context is passed to every database query and migration handler,
+	// migrator stops before the next migration when the context is done and returns ErrInterrupted.
+	RunContext(ctx context.Context) error
+	RunCheckContext(ctx context.Context) (Plan, error)
+	RunStepContext(ctx context.Context, step int) error
+	RunStepCheckContext(ctx context.Context, step int) (Plan, error)
+	RollbackStepContext(ctx context.Context, step int) error
+	RollbackStepCheckContext(ctx context.Context, step int) (Plan, error)
+	RollbackBatchContext(ctx context.Context, batches int) error
+	RollbackLastBatchContext(ctx context.Context) error
+	RunToContext(ctx context.Context, id string) error
+	RollbackToContext(ctx context.Context, id string) error
+	ResetContext(ctx context.Context) error
+	RefreshContext(ctx context.Context) error
+	RedoContext(ctx context.Context, step int) error
+	ForceContext(ctx context.Context, id string, applied bool) error
+	StatusContext(ctx context.Context) (Status, error)
+	VerifyContext(ctx context.Context) error
+	RepairContext(ctx context.Context, dryRun bool) (RepairReport, error)
 }
 
 // Resolver provides a list of executed migrations
@@ -45,143 +116,456 @@ type Resolver func(db *gorm.DB) []string
 type Config struct {
 	// Db gorm db client
 	Db *gorm.DB
-	// Table where the list of executed migrations is stored
+	// Table where the list of executed migrations is stored, may be schema qualified, e.g. audit.migrations.
+	// Table "migrations" is used, if empty
 	Table string
 	// default migration resolver is used, if nil
 	Logger ILogger
+	// AppVersion application version that is stored along with every executed migration
+	AppVersion string
+	// Locker guards Run, RunStep and rollback methods from being executed by several processes at the same time,
+	// see NewLocker. No locking is used, if nil
+	Locker Locker
+	// IdPolicy naming policy that every migration id must satisfy, see IdPattern and TimestampPrefix.
+	// Any id is allowed, if nil
+	IdPolicy IdPolicy
+	// Atomic execute all migrations of one run in a single transaction, nothing is applied if any of them fails.
+	// Requires database with transactional DDL, e.g. Postgres or SQLite
+	Atomic bool
+	// Compensate roll back migrations executed by the run in reverse order, when one of the next migrations fails.
+	// Failure is returned as ErrRunFailed with result of the compensation. Not used in atomic mode
+	Compensate bool
 }
 
 type Migrator struct {
 	migrations     []Migration
 	config         Config
+	table          string
 	executedCount  int
 	availableCount int
+	// host and database user that are stored along with every executed migration
+	host   string
+	dbUser string
 }
 
 type migration struct {
-	Id        int    `gorm:"primaryKey;autoIncrement;type:uint;size:10;not null"`
-	Migration string `gorm:"type:string;size:191;not null"`
-}
-
-func (migration) TableName() string {
-	return defaultMigrationTableName
+	Id         int        `gorm:"primaryKey;autoIncrement;type:uint;size:10;not null"`
+	Migration  string     `gorm:"type:string;size:191;not null;uniqueIndex"`
+	Batch      int        `gorm:"type:uint;size:32;not null;default:0"`
+	AppliedAt  *time.Time `gorm:"column:applied_at"`
+	Duration   int64      `gorm:"column:duration_ms;not null;default:0"`
+	Checksum   string     `gorm:"type:string;size:64;not null;default:''"`
+	AppVersion string     `gorm:"type:string;size:191;not null;default:''"`
+	Host       string     `gorm:"type:string;size:191;not null;default:''"`
+	DbUser     string     `gorm:"type:string;size:191;not null;default:''"`
+	// Dirty migration is being executed or rolled back without transaction, or has failed halfway
+	Dirty bool `gorm:"not null;default:false"`
 }
 
 func NewMigrator(migrations []Migration, config Config) (*Migrator, error) {
+	err := ValidateMigrations(migrations, config.IdPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	if config.Logger == nil {
 		config.Logger = NewStdoutLogger(true)
 	}
 	m := Migrator{
 		migrations: migrations,
 		config:     config,
+		table:      defaultMigrationTableName,
 	}
 
 	if m.config.Table != "" {
-		defaultMigrationTableName = m.config.Table
+		m.table = m.config.Table
 	}
 
-	err := m.createMigrationTable()
+	if m.config.Atomic && !m.hasTransactionalDDL() {
+		return nil, ErrAtomicNotSupported
+	}
+
+	err = m.createMigrationTable()
 	if err != nil {
 		return nil, err
 	}
 
+	m.host, _ = os.Hostname()
+	m.dbUser = m.getDbUser()
+
 	return &m, nil
 }
 
 // create migration table in database
+// missing columns are added to the existing table
 func (m *Migrator) createMigrationTable() error {
-	return m.config.Db.AutoMigrate(migration{})
+	if schema, table, ok := strings.Cut(m.table, "."); ok && m.config.Db.Dialector.Name() == "mysql" {
+		return m.createMysqlSchemaMigrationTable(schema, table)
+	}
+	return m.config.Db.Table(m.table).AutoMigrate(migration{})
+}
+
+// create migration table in the specified mysql schema
+// gorm looks for the table in the current database on mysql, so existing table and its columns are resolved here
+func (m *Migrator) createMysqlSchemaMigrationTable(schema, table string) error {
+	var columns []string
+	err := m.config.Db.Raw(
+		"select column_name from information_schema.columns where table_schema = ? and table_name = ?",
+		schema,
+		table,
+	).Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	tableMigrator := m.config.Db.Table(m.table).Migrator()
+	if len(columns) == 0 {
+		return tableMigrator.CreateTable(migration{})
+	}
+
+	stmt := &gorm.Statement{DB: m.config.Db}
+	err = stmt.Parse(migration{})
+	if err != nil {
+		return err
+	}
+	for _, column := range stmt.Schema.DBNames {
+		if Contains(columns, column) {
+			continue
+		}
+		err = tableMigrator.AddColumn(migration{}, column)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get migrations table name quoted for raw queries
+func (m *Migrator) quotedTable() string {
+	return m.config.Db.Statement.Quote(m.table)
+}
+
+// get current database user, empty string if dialect is not supported or user can't be resolved
+func (m *Migrator) getDbUser() string {
+	var query string
+	switch m.config.Db.Dialector.Name() {
+	case "mysql":
+		query = "select current_user()"
+	case "postgres":
+		query = "select current_user"
+	case "sqlserver":
+		query = "select suser_name()"
+	default:
+		return ""
+	}
+
+	var user string
+	err := m.config.Db.Raw(query).Scan(&user).Error
+	if err != nil {
+		return ""
+	}
+	return user
 }
 
 // get list of executed migrations from migrations repository
-func (m *Migrator) getExecutedMigrationList() ([]string, error) {
-	var list []string
+func (m *Migrator) getExecutedMigrationList(ctx context.Context) ([]migration, error) {
+	var list []migration
 
 	err := m.config.Db.
-		Table(defaultMigrationTableName).
-		Select("migration").
+		WithContext(ctx).
+		Table(m.table).
 		Order("id asc").
 		Scan(&list).Error
 
 	return list, err
 }
 
-// mark migration as executed by adding it to migrations repository
-func (m *Migrator) markMigrationExecuted(id string, tx *gorm.DB) error {
-	return tx.Exec("insert into "+defaultMigrationTableName+" (migration) values (?)", id).Error
+// create migrations repository record with execution metadata
+func (m *Migrator) newMigrationRecord(executed Migration, batch int, appliedAt time.Time) migration {
+	return migration{
+		Migration:  executed.Id,
+		Batch:      batch,
+		AppliedAt:  &appliedAt,
+		Duration:   time.Since(appliedAt).Milliseconds(),
+		Checksum:   executed.Checksum,
+		AppVersion: m.config.AppVersion,
+		Host:       m.host,
+		DbUser:     m.dbUser,
+	}
+}
+
+// mark migration as executed by adding it to migrations repository with execution metadata
+func (m *Migrator) markMigrationExecuted(record migration, tx *gorm.DB) error {
+	return tx.Exec(
+		"insert into "+m.quotedTable()+
+			" (migration, batch, applied_at, duration_ms, checksum, app_version, host, db_user, dirty)"+
+			" values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		record.Migration,
+		record.Batch,
+		record.AppliedAt,
+		record.Duration,
+		record.Checksum,
+		record.AppVersion,
+		record.Host,
+		record.DbUser,
+		record.Dirty,
+	).Error
+}
+
+// set or clear dirty mark of executed migration
+func (m *Migrator) setMigrationDirtyMark(id string, dirty bool, tx *gorm.DB) error {
+	return tx.Exec("update "+m.quotedTable()+" set dirty = ? where migration = ?", dirty, id).Error
+}
+
+// clear dirty mark of migration after successful execution, execution duration is updated as well
+func (m *Migrator) clearMigrationDirtyMark(record migration, tx *gorm.DB) error {
+	return tx.Exec(
+		"update "+m.quotedTable()+" set dirty = ?, duration_ms = ? where migration = ?",
+		false,
+		record.Duration,
+		record.Migration,
+	).Error
 }
 
 // remove migration from executed list - remove it from migrations repository
 func (m *Migrator) removeMigrationExecutedMark(id string, tx *gorm.DB) error {
-	return tx.Exec("delete from "+defaultMigrationTableName+" where migration = ?", id).Error
+	return tx.Exec("delete from "+m.quotedTable()+" where migration = ?", id).Error
 }
 
 // execute specified migration handlers in transaction
-func (m *Migrator) executeMigration(migration Migration, action int) error {
-	err := m.config.Db.Transaction(func(tx *gorm.DB) error {
+// batch is used only for actionMigrate, dirty reports that failed migration is left marked as dirty
+func (m *Migrator) executeMigration(ctx context.Context, migration Migration, action int, batch int) (dirty bool, err error) {
+	if m.usesDirtyMark(migration) {
+		return m.executeMigrationWithDirtyMark(ctx, migration, action, batch)
+	}
+	err = m.config.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if action == actionMigrate {
+			return m.migrate(tx, migration, batch)
+		}
+		err := migration.Rollback(tx)
+		if err != nil {
+			return err
+		}
+		return m.removeMigrationExecutedMark(migration.Id, tx)
+	})
+	return false, err
+}
+
+// invoke migrate handler and mark migration as executed
+func (m *Migrator) migrate(tx *gorm.DB, migration Migration, batch int) error {
+	appliedAt := time.Now()
+	err := migration.Migrate(tx)
+	if err != nil {
+		return err
+	}
+	return m.markMigrationExecuted(m.newMigrationRecord(migration, batch, appliedAt), tx)
+}
+
+// check that migration is marked as dirty while it is running, so it stays dirty if it fails.
+// Changes of migration without transaction or on database without transactional DDL can't be undone on failure.
+func (m *Migrator) usesDirtyMark(migration Migration) bool {
+	return migration.NoTransaction || !m.hasTransactionalDDL()
+}
+
+// execute specified migration handlers, in transaction unless migration opts out of it
+// migration is marked as dirty outside of transaction before handler is invoked and the mark is cleared after it succeeds,
+// so migration that has failed halfway stays dirty, dirty is false if migration has failed before the mark is set
+func (m *Migrator) executeMigrationWithDirtyMark(ctx context.Context, migration Migration, action int, batch int) (dirty bool, err error) {
+	db := m.config.Db.WithContext(ctx)
+	run := db.Transaction
+	if migration.NoTransaction {
+		run = func(fc func(tx *gorm.DB) error, _ ...*sql.TxOptions) error {
+			return fc(db)
+		}
+	}
+
+	if action == actionMigrate {
+		appliedAt := time.Now()
+		record := m.newMigrationRecord(migration, batch, appliedAt)
+		record.Dirty = true
+		err = m.markMigrationExecuted(record, db)
+		if err != nil {
+			return false, err
+		}
+		err = run(func(tx *gorm.DB) error {
 			err := migration.Migrate(tx)
 			if err != nil {
 				return err
 			}
-			return m.markMigrationExecuted(migration.Id, tx)
-		}
+			return m.clearMigrationDirtyMark(m.newMigrationRecord(migration, batch, appliedAt), tx)
+		})
+		return err != nil, err
+	}
+
+	err = m.setMigrationDirtyMark(migration.Id, true, db)
+	if err != nil {
+		return false, err
+	}
+	err = run(func(tx *gorm.DB) error {
 		err := migration.Rollback(tx)
 		if err != nil {
 			return err
 		}
 		return m.removeMigrationExecutedMark(migration.Id, tx)
 	})
-	return err
+	return err != nil, err
 }
 
-// get migrations that have not been executed yet
-func (m *Migrator) getMigrationsForRun() ([]Migration, error) {
-	executed, err := m.getExecutedMigrationList()
+// check that DDL statements are rolled back along with transaction,
+// otherwise failed migration may leave the database changed
+func (m *Migrator) hasTransactionalDDL() bool {
+	switch m.config.Db.Dialector.Name() {
+	case "postgres", "sqlite", "sqlserver":
+		return true
+	default:
+		return false
+	}
+}
+
+// get list of executed migrations, fails with ErrDirty if any migration is dirty
+func (m *Migrator) getCleanMigrationList(ctx context.Context) ([]migration, error) {
+	executed, err := m.getExecutedMigrationList(ctx)
 	if err != nil {
 		return nil, err
 	}
+	for _, record := range executed {
+		if record.Dirty {
+			return nil, ErrDirty{Id: record.Migration}
+		}
+	}
+	return executed, nil
+}
+
+// get ids of executed migrations
+func executedIds(executed []migration) []string {
+	ids := make([]string, 0, len(executed))
+	for _, record := range executed {
+		ids = append(ids, record.Migration)
+	}
+	return ids
+}
+
+// get number of the last executed batch, 0 if nothing has been executed
+func lastBatch(executed []migration) int {
+	last := 0
+	for _, record := range executed {
+		if record.Batch > last {
+			last = record.Batch
+		}
+	}
+	return last
+}
+
+// get migrations that have not been executed yet
+func (m *Migrator) getMigrationsForRun(executed []migration) []Migration {
+	ids := executedIds(executed)
 
 	var res []Migration
-	if executed == nil {
-		for _, migration := range m.migrations {
-			res = append(res, migration)
+	for _, migration := range m.migrations {
+		if Contains(ids, migration.Id) {
+			continue
 		}
-	} else {
-		for _, migration := range m.migrations {
-			if Contains(executed, migration.Id) {
-				continue
-			}
+		res = append(res, migration)
+	}
+
+	return res
+}
+
+// get position of migration in the declared list, -1 if migration is not declared
+func (m *Migrator) getMigrationIndex(id string) int {
+	for i, migration := range m.migrations {
+		if migration.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// get migrations that have been executed already in order of their execution
+func (m *Migrator) getMigrationsForRollback(executed []migration) []Migration {
+	var res []Migration
+	for _, record := range executed {
+		i := m.getMigrationIndex(record.Migration)
+		if i < 0 {
+			continue
+		}
+		res = append(res, m.migrations[i])
+	}
+
+	return res
+}
+
+// get ids of executed migrations that have been executed after a migration declared later than them
+func (m *Migrator) getOutOfOrderMigrations(executed []migration) []string {
+	var res []string
+	latest := -1
+	for _, record := range executed {
+		i := m.getMigrationIndex(record.Migration)
+		if i < 0 {
+			continue
+		}
+		if i < latest {
+			res = append(res, record.Migration)
+			continue
+		}
+		latest = i
+	}
+	return res
+}
+
+// compare execution order with declared order and warn about every mismatch
+func (m *Migrator) checkExecutionOrder(executed []migration) {
+	for _, id := range m.getOutOfOrderMigrations(executed) {
+		m.config.Logger.Warn(migrationOutOfOrder, "id", id)
+	}
+}
+
+// get migrations that have not been executed yet and are declared before or equal to the target migration
+func (m *Migrator) getMigrationsForRunTo(executed []migration, target int) []Migration {
+	var res []Migration
+	for _, migration := range m.getMigrationsForRun(executed) {
+		if m.getMigrationIndex(migration.Id) <= target {
 			res = append(res, migration)
 		}
 	}
+	return res
+}
 
-	return res, nil
+// get migrations that have been executed after the target migration in order of their execution
+func (m *Migrator) getMigrationsForRollbackTo(executed []migration, id string) ([]Migration, error) {
+	forRollback := m.getMigrationsForRollback(executed)
+	for i, migration := range forRollback {
+		if migration.Id == id {
+			return forRollback[i+1:], nil
+		}
+	}
+	return nil, ErrInvalidTarget{Id: id, Reason: "migration is not executed"}
 }
 
-// get migrations that have been executed already
-func (m *Migrator) getMigrationsForRollback() ([]Migration, error) {
-	executed, err := m.getExecutedMigrationList()
-	if err != nil {
-		return nil, err
+// get executed migrations that belong to the specified quantity of last batches
+func (m *Migrator) getMigrationsForBatchRollback(executed []migration, batches int) []Migration {
+	var ids []string
+	last := lastBatch(executed)
+	for _, record := range executed {
+		if record.Batch > last-batches {
+			ids = append(ids, record.Migration)
+		}
 	}
 
 	var res []Migration
-	if executed != nil {
-		for _, migration := range m.migrations {
-			if Contains(executed, migration.Id) {
-				res = append(res, migration)
-			}
+	for _, migration := range m.getMigrationsForRollback(executed) {
+		if Contains(ids, migration.Id) {
+			res = append(res, migration)
 		}
 	}
 
-	return res, nil
+	return res
 }
 
 // invoke runner for list of migrations
-func (m *Migrator) runMigrationList(list []Migration, count int, runner func(Migration) error) error {
+func (m *Migrator) runMigrationList(ctx context.Context, list []Migration, count int, runner func(Migration) error) error {
 	for i := 0; i < len(list) && i < count; i++ {
-		err := runner(list[i])
+		err := m.invokeRunner(ctx, list[i], runner)
 		if err != nil {
 			return err
 		}
@@ -189,7 +573,7 @@ func (m *Migrator) runMigrationList(list []Migration, count int, runner func(Mig
 	return nil
 }
 
-func (m *Migrator) rollbackMigrationList(list []Migration, count int, runner func(Migration) error) error {
+func (m *Migrator) rollbackMigrationList(ctx context.Context, list []Migration, count int, runner func(Migration) error) error {
 	lenList := len(list)
 
 	if count > lenList {
@@ -197,7 +581,7 @@ func (m *Migrator) rollbackMigrationList(list []Migration, count int, runner fun
 	}
 
 	for i := 0; i < count; i++ {
-		err := runner(list[lenList-1-i])
+		err := m.invokeRunner(ctx, list[lenList-1-i], runner)
 		if err != nil {
 			return err
 		}
@@ -206,116 +590,410 @@ func (m *Migrator) rollbackMigrationList(list []Migration, count int, runner fun
 	return nil
 }
 
-func (m *Migrator) Run() error {
-	forRun, err := m.getMigrationsForRun()
+// invoke runner for migration unless context is done,
+// runner error caused by done context is reported as interruption of the migration
+func (m *Migrator) invokeRunner(ctx context.Context, migration Migration, runner func(Migration) error) error {
+	if ctx.Err() != nil {
+		return ErrInterrupted{Id: migration.Id, Err: ctx.Err()}
+	}
+	err := runner(migration)
+	if err != nil && ctx.Err() != nil {
+		return ErrInterrupted{Id: migration.Id, Err: err}
+	}
+	return err
+}
+
+// hold the lock while fn is executed, if locker is configured
+func (m *Migrator) withLock(ctx context.Context, fn func() error) (err error) {
+	if m.config.Locker == nil {
+		return fn()
+	}
+
+	err = m.config.Locker.Lock(ctx)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		// ctx may be done already, e.g. when deploy timeout is reached, but the lock must be released anyway
+		unlockCtx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		unlockErr := m.config.Locker.Unlock(unlockCtx)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return fn()
+}
+
+// execute specified quantity of new migrations as one batch
+func (m *Migrator) runStep(ctx context.Context, step int) error {
+	executed, err := m.getCleanMigrationList(ctx)
+	if err != nil {
+		return err
+	}
+	return m.runList(ctx, m.getMigrationsForRun(executed), step, lastBatch(executed)+1)
+}
+
+// execute specified quantity of migrations from the list as one batch
+func (m *Migrator) runList(ctx context.Context, forRun []Migration, step int, batch int) error {
 	if len(forRun) == 0 {
 		m.config.Logger.Info(noAvailableMigrations)
 		return nil
 	}
-	err = m.runMigrationList(forRun, len(forRun), func(migration Migration) error {
-		err := m.executeMigration(migration, actionMigrate)
+	if m.config.Atomic {
+		return m.runListAtomic(ctx, forRun, step, batch)
+	}
+	var executed []Migration
+	// failed migration has been left dirty
+	dirty := false
+	err := m.runMigrationList(ctx, forRun, step, func(migration Migration) error {
+		var err error
+		dirty, err = m.executeMigration(ctx, migration, actionMigrate, batch)
 		if err != nil {
 			m.config.Logger.Info(migrationFailed, "id", migration.Id, "err", err)
 			return err
 		}
 		m.config.Logger.Info(migrationExecuted, "id", migration.Id)
+		executed = append(executed, migration)
 		return nil
 	})
+	if err != nil && m.config.Compensate {
+		// migration next to the executed ones has failed
+		failed := forRun[len(executed)]
+		// ctx may be done already, e.g. when deploy timeout is reached, but the schema must be restored anyway
+		compensationCtx, cancel := context.WithTimeout(context.Background(), compensationTimeout)
+		defer cancel()
+		return m.compensate(compensationCtx, executed, ErrRunFailed{Id: failed.Id, Err: err, Dirty: dirty})
+	}
 	return err
 }
 
-func (m *Migrator) RunCheck() error {
-	forRun, err := m.getMigrationsForRun()
+// roll back migrations executed by the failed run in reverse order,
+// compensation stops on the first failure, because earlier migrations may depend on the one that can't be rolled back
+func (m *Migrator) compensate(ctx context.Context, executed []Migration, failure ErrRunFailed) error {
+	for i := len(executed) - 1; i >= 0; i-- {
+		migration := executed[i]
+		var err error
+		if !migration.IsReversible() {
+			err = ErrIrreversible{Id: migration.Id}
+		} else {
+			_, err = m.executeMigration(ctx, migration, actionRollback, 0)
+		}
+		if err != nil {
+			m.config.Logger.Info(compensationFailed, "id", migration.Id, "err", err)
+			failure.CompensationFailure = &ErrCompensationFailed{Id: migration.Id, Err: err}
+			return failure
+		}
+		m.config.Logger.Info(migrationRolledBack, "id", migration.Id)
+		failure.RolledBack = append(failure.RolledBack, migration.Id)
+	}
+	return failure
+}
+
+// execute specified quantity of migrations from the list as one batch in a single transaction
+func (m *Migrator) runListAtomic(ctx context.Context, forRun []Migration, step int, batch int) error {
+	for i := 0; i < len(forRun) && i < step; i++ {
+		if forRun[i].NoTransaction {
+			return ErrNotAtomic{Id: forRun[i].Id}
+		}
+	}
+
+	var executed []string
+	err := m.config.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return m.runMigrationList(ctx, forRun, step, func(migration Migration) error {
+			err := m.migrate(tx, migration, batch)
+			if err != nil {
+				m.config.Logger.Info(migrationFailed, "id", migration.Id, "err", err)
+				return err
+			}
+			executed = append(executed, migration.Id)
+			return nil
+		})
+	})
 	if err != nil {
+		m.config.Logger.Info(atomicRunRolledBack, "ids", executed)
 		return err
 	}
-	if len(forRun) == 0 {
-		m.config.Logger.Info(noAvailableMigrations)
-		return nil
+
+	for _, id := range executed {
+		m.config.Logger.Info(migrationExecuted, "id", id)
 	}
-	err = m.runMigrationList(forRun, len(forRun), func(migration Migration) error {
-		m.config.Logger.Info(migrationExecuted, "id", migration.Id)
-		return nil
-	})
-	return err
+	return nil
 }
 
-func (m *Migrator) RunStep(step int) error {
-	forRun, err := m.getMigrationsForRun()
+// plan specified quantity of new migrations
+func (m *Migrator) runStepCheck(ctx context.Context, step int) (Plan, error) {
+	executed, err := m.getCleanMigrationList(ctx)
 	if err != nil {
-		return err
+		return Plan{}, err
 	}
-	if len(forRun) == 0 {
+	plan := newRunPlan(m.getMigrationsForRun(executed), step)
+	plan.Log(m.config.Logger)
+	return plan, nil
+}
+
+// roll back specified quantity of migrations from the list starting from the last one
+func (m *Migrator) rollbackStep(ctx context.Context, forRollback []Migration, step int) error {
+	if len(forRollback) == 0 {
 		m.config.Logger.Info(noAvailableMigrations)
 		return nil
 	}
-	err = m.runMigrationList(forRun, step, func(migration Migration) error {
-		err := m.executeMigration(migration, actionMigrate)
+	err := newRollbackPlan(forRollback, step, nil).checkReversible()
+	if err != nil {
+		return err
+	}
+	err = m.rollbackMigrationList(ctx, forRollback, step, func(migration Migration) error {
+		_, err := m.executeMigration(ctx, migration, actionRollback, 0)
 		if err != nil {
 			m.config.Logger.Info(migrationFailed, "id", migration.Id, "err", err)
 			return err
 		}
-		m.config.Logger.Info(migrationExecuted, "id", migration.Id)
+		m.config.Logger.Info(migrationRolledBack, "id", migration.Id)
 		return nil
 	})
 	return err
 }
 
-func (m *Migrator) RunStepCheck(step int) error {
-	forRun, err := m.getMigrationsForRun()
+func (m *Migrator) Run() error {
+	return m.RunContext(context.Background())
+}
+
+func (m *Migrator) RunContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		return m.runStep(ctx, len(m.migrations))
+	})
+}
+
+func (m *Migrator) RunCheck() (Plan, error) {
+	return m.RunCheckContext(context.Background())
+}
+
+func (m *Migrator) RunCheckContext(ctx context.Context) (Plan, error) {
+	return m.runStepCheck(ctx, len(m.migrations))
+}
+
+func (m *Migrator) RunStep(step int) error {
+	return m.RunStepContext(context.Background(), step)
+}
+
+func (m *Migrator) RunStepContext(ctx context.Context, step int) error {
+	return m.withLock(ctx, func() error {
+		return m.runStep(ctx, step)
+	})
+}
+
+func (m *Migrator) RunStepCheck(step int) (Plan, error) {
+	return m.RunStepCheckContext(context.Background(), step)
+}
+
+func (m *Migrator) RunStepCheckContext(ctx context.Context, step int) (Plan, error) {
+	return m.runStepCheck(ctx, step)
+}
+
+func (m *Migrator) RollbackStep(step int) error {
+	return m.RollbackStepContext(context.Background(), step)
+}
+
+func (m *Migrator) RollbackStepContext(ctx context.Context, step int) error {
+	return m.withLock(ctx, func() error {
+		executed, err := m.getCleanMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+		m.checkExecutionOrder(executed)
+		return m.rollbackStep(ctx, m.getMigrationsForRollback(executed), step)
+	})
+}
+
+func (m *Migrator) RollbackStepCheck(step int) (Plan, error) {
+	return m.RollbackStepCheckContext(context.Background(), step)
+}
+
+func (m *Migrator) RollbackStepCheckContext(ctx context.Context, step int) (Plan, error) {
+	executed, err := m.getCleanMigrationList(ctx)
 	if err != nil {
-		return err
+		return Plan{}, err
 	}
-	if len(forRun) == 0 {
-		m.config.Logger.Info(noAvailableMigrations)
-		return nil
-	}
-	err = m.runMigrationList(forRun, step, func(migration Migration) error {
-		m.config.Logger.Info(migrationExecuted, "id", migration.Id)
-		return nil
+	m.checkExecutionOrder(executed)
+	plan := newRollbackPlan(m.getMigrationsForRollback(executed), step, executed)
+	plan.Log(m.config.Logger)
+	return plan, plan.checkReversible()
+}
+
+func (m *Migrator) RollbackBatch(batches int) error {
+	return m.RollbackBatchContext(context.Background(), batches)
+}
+
+func (m *Migrator) RollbackBatchContext(ctx context.Context, batches int) error {
+	return m.withLock(ctx, func() error {
+		executed, err := m.getCleanMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+		m.checkExecutionOrder(executed)
+		forRollback := m.getMigrationsForBatchRollback(executed, batches)
+		return m.rollbackStep(ctx, forRollback, len(forRollback))
 	})
-	return err
 }
 
-func (m *Migrator) RollbackStep(step int) error {
-	forRollback, err := m.getMigrationsForRollback()
+func (m *Migrator) RollbackLastBatch() error {
+	return m.RollbackLastBatchContext(context.Background())
+}
+
+func (m *Migrator) RollbackLastBatchContext(ctx context.Context) error {
+	return m.RollbackBatchContext(ctx, 1)
+}
+
+func (m *Migrator) Status() (Status, error) {
+	return m.StatusContext(context.Background())
+}
+
+func (m *Migrator) StatusContext(ctx context.Context) (Status, error) {
+	executed, err := m.getExecutedMigrationList(ctx)
 	if err != nil {
-		return err
+		return Status{}, err
 	}
-	if len(forRollback) == 0 {
-		m.config.Logger.Info(noAvailableMigrations)
-		return nil
+	return m.getStatus(executed), nil
+}
+
+func (m *Migrator) RunTo(id string) error {
+	return m.RunToContext(context.Background(), id)
+}
+
+func (m *Migrator) RunToContext(ctx context.Context, id string) error {
+	target := m.getMigrationIndex(id)
+	if target < 0 {
+		return ErrUnknownMigration{Id: id}
 	}
-	err = m.rollbackMigrationList(forRollback, step, func(migration Migration) error {
-		err := m.executeMigration(migration, actionRollback)
+	return m.withLock(ctx, func() error {
+		executed, err := m.getCleanMigrationList(ctx)
 		if err != nil {
-			m.config.Logger.Info(migrationFailed, "id", migration.Id, "err", err)
 			return err
 		}
-		m.config.Logger.Info(migrationRolledBack, "id", migration.Id)
-		return nil
+		forRun := m.getMigrationsForRunTo(executed, target)
+		return m.runList(ctx, forRun, len(forRun), lastBatch(executed)+1)
+	})
+}
+
+func (m *Migrator) RollbackTo(id string) error {
+	return m.RollbackToContext(context.Background(), id)
+}
+
+func (m *Migrator) RollbackToContext(ctx context.Context, id string) error {
+	if m.getMigrationIndex(id) < 0 {
+		return ErrUnknownMigration{Id: id}
+	}
+	return m.withLock(ctx, func() error {
+		executed, err := m.getCleanMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+		m.checkExecutionOrder(executed)
+		forRollback, err := m.getMigrationsForRollbackTo(executed, id)
+		if err != nil {
+			return err
+		}
+		return m.rollbackStep(ctx, forRollback, len(forRollback))
 	})
-	return err
 }
 
-func (m *Migrator) RollbackStepCheck(step int) error {
-	forRollback, err := m.getMigrationsForRollback()
+// roll back all executed migrations
+func (m *Migrator) reset(ctx context.Context) error {
+	executed, err := m.getCleanMigrationList(ctx)
 	if err != nil {
 		return err
 	}
-	if len(forRollback) == 0 {
-		m.config.Logger.Info(noAvailableMigrations)
-		return nil
-	}
-	if step == 0 {
-		return nil
+	m.checkExecutionOrder(executed)
+	forRollback := m.getMigrationsForRollback(executed)
+	return m.rollbackStep(ctx, forRollback, len(forRollback))
+}
+
+func (m *Migrator) Reset() error {
+	return m.ResetContext(context.Background())
+}
+
+func (m *Migrator) ResetContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		return m.reset(ctx)
+	})
+}
+
+func (m *Migrator) Refresh() error {
+	return m.RefreshContext(context.Background())
+}
+
+func (m *Migrator) RefreshContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		err := m.reset(ctx)
+		if err != nil {
+			return err
+		}
+		return m.runStep(ctx, len(m.migrations))
+	})
+}
+
+func (m *Migrator) Redo(step int) error {
+	return m.RedoContext(context.Background(), step)
+}
+
+func (m *Migrator) RedoContext(ctx context.Context, step int) error {
+	return m.withLock(ctx, func() error {
+		executed, err := m.getCleanMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+		m.checkExecutionOrder(executed)
+		forRedo := m.getMigrationsForRollback(executed)
+		if step < 0 {
+			step = 0
+		}
+		if step < len(forRedo) {
+			forRedo = forRedo[len(forRedo)-step:]
+		}
+
+		err = m.rollbackStep(ctx, forRedo, len(forRedo))
+		if err != nil || len(forRedo) == 0 {
+			return err
+		}
+
+		// migrations are executed again in the same order as they have been executed before
+		executed, err = m.getCleanMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+		return m.runList(ctx, forRedo, len(forRedo), lastBatch(executed)+1)
+	})
+}
+
+func (m *Migrator) Force(id string, applied bool) error {
+	return m.ForceContext(context.Background(), id, applied)
+}
+
+func (m *Migrator) ForceContext(ctx context.Context, id string, applied bool) error {
+	index := m.getMigrationIndex(id)
+	if applied && index < 0 {
+		return ErrUnknownMigration{Id: id}
 	}
-	err = m.rollbackMigrationList(forRollback, step, func(migration Migration) error {
-		m.config.Logger.Info(migrationRolledBack, "id", migration.Id)
+	return m.withLock(ctx, func() error {
+		executed, err := m.getExecutedMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+
+		db := m.config.Db.WithContext(ctx)
+		if !applied {
+			err = m.removeMigrationExecutedMark(id, db)
+		} else if Contains(executedIds(executed), id) {
+			err = m.setMigrationDirtyMark(id, false, db)
+		} else {
+			err = m.markMigrationExecuted(m.newMigrationRecord(m.migrations[index], lastBatch(executed)+1, time.Now()), db)
+		}
+		if err != nil {
+			return err
+		}
+
+		m.config.Logger.Info(migrationForced, "id", id, "applied", applied)
 		return nil
 	})
-	return err
 }
@@ -1,6 +1,9 @@
 package migrator
 
 import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/vshapovalov/gorm-migrator/mocks"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
@@ -11,11 +14,16 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
-const testMigrationTable = "migrations_table"
+const (
+	testMigrationTable = "migrations_table"
+	testAppVersion     = "1.0.0"
+	testDbUser         = "migrator@localhost"
+)
 
 func Test_Migrator_RunCheck(t *testing.T) {
 
@@ -25,7 +33,7 @@ func Test_Migrator_RunCheck(t *testing.T) {
 
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
@@ -35,8 +43,10 @@ func Test_Migrator_RunCheck(t *testing.T) {
 	// expecting list of migrations that would be executed - 1,3,4
 	expectSuccessCheck(loggerMock, migrations[1], migrations[3], migrations[4])
 
-	err = migrator.RunCheck()
+	plan, err := migrator.RunCheck()
 	require.NoError(t, err)
+	require.Equal(t, DirectionUp, plan.Direction)
+	require.Equal(t, []string{migrations[1].Id, migrations[3].Id, migrations[4].Id}, plan.Ids())
 
 	loggerMock.AssertExpectations(t)
 	require.NoError(t, sqlMock.ExpectationsWereMet())
@@ -50,7 +60,7 @@ func Test_Migrator_Run(t *testing.T) {
 
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
@@ -58,7 +68,7 @@ func Test_Migrator_Run(t *testing.T) {
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2], migrations[4])
 
 	// expecting list of migrations that would be executed - 1,3,4
-	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, migrations[1], migrations[3])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[1], migrations[3])
 
 	err = migrator.Run()
 	require.NoError(t, err)
@@ -74,7 +84,7 @@ func Test_Migrator_RunStepCheck(t *testing.T) {
 	migrations := createTestMigrations()
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
@@ -84,8 +94,9 @@ func Test_Migrator_RunStepCheck(t *testing.T) {
 	// expecting list of 2 migrations that would be executed - 1,3
 	expectSuccessCheck(loggerMock, migrations[1], migrations[3])
 
-	err = migrator.RunStepCheck(2)
+	plan, err := migrator.RunStepCheck(2)
 	require.NoError(t, err)
+	require.Equal(t, []string{migrations[1].Id, migrations[3].Id}, plan.Ids())
 
 	loggerMock.AssertExpectations(t)
 	require.NoError(t, sqlMock.ExpectationsWereMet())
@@ -98,7 +109,7 @@ func Test_Migrator_RunStep(t *testing.T) {
 	migrations := createTestMigrations()
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
@@ -106,7 +117,7 @@ func Test_Migrator_RunStep(t *testing.T) {
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2])
 
 	// expecting list of 2 migrations that would be executed - 1,3
-	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, migrations[1], migrations[3])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[1], migrations[3])
 
 	err = migrator.RunStep(2)
 	require.NoError(t, err)
@@ -122,46 +133,53 @@ func Test_Migrator_RollbackStepCheck(t *testing.T) {
 	migrations := createTestMigrations()
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
 	// no migrations rollback
 	exceptExecutedMigrations(sqlMock, testMigrationTable)
 	loggerMock.On("Info", noAvailableMigrations)
-	err = migrator.RollbackStepCheck(2)
+	plan, err := migrator.RollbackStepCheck(2)
 	require.NoError(t, err)
+	require.True(t, plan.Empty())
 
 	// last migration rolled back
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations...)
 	//	show last 2 executed migrations
 	expectRollbackCheck(loggerMock, migrations[4])
-	err = migrator.RollbackStepCheck(1)
+	plan, err = migrator.RollbackStepCheck(1)
 	require.NoError(t, err)
+	require.Equal(t, DirectionDown, plan.Direction)
+	require.Equal(t, []string{migrations[4].Id}, plan.Ids())
 
 	// all migrations rolled back
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations...)
 	expectRollbackCheck(loggerMock, migrations...)
-	err = migrator.RollbackStepCheck(len(migrations))
+	plan, err = migrator.RollbackStepCheck(len(migrations))
 	require.NoError(t, err)
+	require.Len(t, plan.Steps, len(migrations))
 
 	// no migrations rolled back
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations...)
 	expectRollbackCheck(loggerMock)
-	err = migrator.RollbackStepCheck(0)
+	plan, err = migrator.RollbackStepCheck(0)
 	require.NoError(t, err)
+	require.True(t, plan.Empty())
 
 	// 3 migrations rolled back
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[1], migrations[2], migrations[4])
 	expectRollbackCheck(loggerMock, migrations[4], migrations[2], migrations[1])
-	err = migrator.RollbackStepCheck(3)
+	plan, err = migrator.RollbackStepCheck(3)
 	require.NoError(t, err)
+	require.Equal(t, []string{migrations[4].Id, migrations[2].Id, migrations[1].Id}, plan.Ids())
 
 	// 2 migrations rolled back
 	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[1], migrations[2], migrations[4])
 	expectRollbackCheck(loggerMock, migrations[4], migrations[2])
-	err = migrator.RollbackStepCheck(2)
+	plan, err = migrator.RollbackStepCheck(2)
 	require.NoError(t, err)
+	require.Equal(t, []string{migrations[4].Id, migrations[2].Id}, plan.Ids())
 
 	loggerMock.AssertExpectations(t)
 	require.NoError(t, sqlMock.ExpectationsWereMet())
@@ -174,7 +192,7 @@ func Test_Migrator_RollbackStep(t *testing.T) {
 	migrations := createTestMigrations()
 	sqlMock, dbClient, err := createDbClient()
 	require.NoError(t, err)
-	expectCreateTable(sqlMock, testMigrationTable)
+	expectInit(sqlMock, testMigrationTable)
 	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
 	require.NoError(t, err)
 
@@ -219,14 +237,727 @@ func Test_Migrator_RollbackStep(t *testing.T) {
 	require.NoError(t, sqlMock.ExpectationsWereMet())
 }
 
+func Test_Migrator_RollbackBatch(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	records := []migration{
+		executedRecord(migrations[0], 1),
+		executedRecord(migrations[1], 1),
+		executedRecord(migrations[2], 2),
+		executedRecord(migrations[3], 3),
+		executedRecord(migrations[4], 3),
+	}
+
+	// no migrations rollback
+	exceptExecutedRecords(sqlMock, testMigrationTable)
+	loggerMock.On("Info", noAvailableMigrations)
+	err = migrator.RollbackLastBatch()
+	require.NoError(t, err)
+
+	// last batch rolled back
+	exceptExecutedRecords(sqlMock, testMigrationTable, records...)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[4], migrations[3])
+	err = migrator.RollbackLastBatch()
+	require.NoError(t, err)
+
+	// two last batches rolled back
+	exceptExecutedRecords(sqlMock, testMigrationTable, records...)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[4], migrations[3], migrations[2])
+	err = migrator.RollbackBatch(2)
+	require.NoError(t, err)
+
+	// all batches rolled back
+	exceptExecutedRecords(sqlMock, testMigrationTable, records...)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[4], migrations[3], migrations[2], migrations[1], migrations[0])
+	err = migrator.RollbackBatch(10)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RollbackStep_ExecutionOrder(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// migration 1 has been executed after migration 3, e.g. after hotfix branch merge
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[3], migrations[1])
+	loggerMock.On("Warn", migrationOutOfOrder, "id", migrations[1].Id)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[1], migrations[3])
+	err = migrator.RollbackStep(2)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RunContext_Interrupted(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// deploy timeout is reached right after migration 1 has been executed
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2])
+	expectExecute(sqlMock, testMigrationTable, 2, migrations[1])
+	loggerMock.
+		On("Info", migrationExecuted, "id", migrations[1].Id).
+		Run(func(mock.Arguments) { cancel() })
+
+	err = migrator.RunContext(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorAs(t, err, &ErrInterrupted{})
+	require.Equal(t, migrations[3].Id, err.(ErrInterrupted).Id)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RunContext_Interrupted_Compensate(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      testMigrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+		Compensate: true,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// deploy timeout is reached right after migration 1 has been executed, migration 1 is rolled back anyway
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0])
+	expectExecute(sqlMock, testMigrationTable, 2, migrations[1])
+	loggerMock.
+		On("Info", migrationExecuted, "id", migrations[1].Id).
+		Run(func(mock.Arguments) { cancel() })
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[1])
+
+	err = migrator.RunContext(ctx)
+	var failure ErrRunFailed
+	require.ErrorAs(t, err, &failure)
+	require.ErrorAs(t, err, &ErrInterrupted{})
+	require.Equal(t, migrations[2].Id, failure.Id)
+	require.Equal(t, []string{migrations[1].Id}, failure.RolledBack)
+	require.Nil(t, failure.CompensationFailure)
+	require.False(t, failure.Dirty)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Status(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// migration 1 is executed after migration 3, removed_migration is no longer registered
+	exceptExecutedRecords(
+		sqlMock,
+		testMigrationTable,
+		executedRecord(migrations[0], 1),
+		executedRecord(migrations[3], 1),
+		migration{Migration: "removed_migration", Batch: 2},
+		executedRecord(migrations[1], 2),
+	)
+
+	status, err := migrator.Status()
+	require.NoError(t, err)
+
+	var states []State
+	for _, migrationStatus := range status.Migrations {
+		states = append(states, migrationStatus.State)
+	}
+	require.Equal(t, []State{StateApplied, StateOutOfOrder, StatePending, StateApplied, StatePending}, states)
+	require.Equal(t, 2, status.Migrations[1].Applied.Batch)
+	require.Nil(t, status.Migrations[2].Applied)
+	require.Len(t, status.Unknown, 1)
+	require.Equal(t, "removed_migration", status.Unknown[0].Id)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Verify(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), executedRecord(migrations[1], 1))
+	require.NoError(t, migrator.Verify())
+
+	// migration 2 has been edited, migration 3 is executed before checksums were stored
+	exceptExecutedRecords(
+		sqlMock,
+		testMigrationTable,
+		executedRecord(migrations[0], 1),
+		migration{Migration: migrations[1].Id, Batch: 1, Checksum: "old_checksum"},
+		migration{Migration: migrations[2].Id, Batch: 1},
+		migration{Migration: "removed_migration", Batch: 1, Checksum: "removed_checksum"},
+	)
+	loggerMock.On("Warn", migrationChecksumMismatch, "id", migrations[1].Id, "applied", "old_checksum", "current", migrations[1].Checksum)
+
+	err = migrator.Verify()
+	require.Equal(t, ErrChecksumMismatch{Drifts: []ChecksumDrift{
+		{Id: migrations[1].Id, Applied: "old_checksum", Current: migrations[1].Checksum},
+	}}, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+	loggerMock.AssertExpectations(t)
+}
+
+func Test_Migrator_Repair(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	records := []migration{
+		executedRecord(migrations[0], 1),
+		{Migration: migrations[1].Id, Batch: 1, Checksum: "old_checksum"},
+		{Migration: "removed_migration", Batch: 1},
+		// executed before checksums were stored
+		{Migration: migrations[2].Id, Batch: 1},
+	}
+	expected := RepairReport{
+		Checksums: []ChecksumDrift{{Id: migrations[1].Id, Applied: "old_checksum", Current: migrations[1].Checksum}},
+		Recorded:  []ChecksumDrift{{Id: migrations[2].Id, Current: migrations[2].Checksum}},
+		Removed:   []string{"removed_migration"},
+	}
+
+	// dry run changes nothing
+	exceptExecutedRecords(sqlMock, testMigrationTable, records...)
+	loggerMock.On("Info", checksumWillBeRepaired, "id", migrations[1].Id, "applied", "old_checksum", "current", migrations[1].Checksum).Once()
+	loggerMock.On("Info", checksumWillBeRecorded, "id", migrations[2].Id, "checksum", migrations[2].Checksum).Once()
+	loggerMock.On("Info", unknownRecordWillBeRemoved, "id", "removed_migration").Once()
+	report, err := migrator.Repair(true)
+	require.NoError(t, err)
+	require.Equal(t, expected, report)
+
+	exceptExecutedRecords(sqlMock, testMigrationTable, records...)
+	sqlMock.ExpectBegin()
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("update "+quoteTable(testMigrationTable)+" set checksum = ? where migration = ?")).
+		WithArgs(migrations[1].Checksum, migrations[1].Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("update "+quoteTable(testMigrationTable)+" set checksum = ? where migration = ?")).
+		WithArgs(migrations[2].Checksum, migrations[2].Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from " + quoteTable(testMigrationTable) + " where migration = ?")).
+		WithArgs("removed_migration").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+	loggerMock.On("Info", checksumRepaired, "id", migrations[1].Id, "applied", "old_checksum", "current", migrations[1].Checksum).Once()
+	loggerMock.On("Info", checksumRecorded, "id", migrations[2].Id, "checksum", migrations[2].Checksum).Once()
+	loggerMock.On("Info", unknownRecordRemoved, "id", "removed_migration").Once()
+	report, err = migrator.Repair(false)
+	require.NoError(t, err)
+	require.Equal(t, expected, report)
+
+	// nothing to repair
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), executedRecord(migrations[1], 1))
+	report, err = migrator.Repair(false)
+	require.NoError(t, err)
+	require.True(t, report.Empty())
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+	loggerMock.AssertExpectations(t)
+}
+
+func Test_Migrator_RunTo(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// unknown target
+	err = migrator.RunTo("unknown")
+	require.ErrorAs(t, err, &ErrUnknownMigration{})
+
+	// migrations 1 and 3 are executed, 4 stays new
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[1], migrations[3])
+	err = migrator.RunTo(migrations[3].Id)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RollbackTo(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// unknown target
+	err = migrator.RollbackTo("unknown")
+	require.ErrorAs(t, err, &ErrUnknownMigration{})
+
+	// target is not executed
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2])
+	err = migrator.RollbackTo(migrations[1].Id)
+	require.ErrorAs(t, err, &ErrInvalidTarget{})
+
+	// migrations executed after migration 1 are rolled back
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2], migrations[4])
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[4], migrations[2])
+	err = migrator.RollbackTo(migrations[1].Id)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Refresh(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()[:3]
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// all executed migrations are rolled back and executed again
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1])
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[1], migrations[0])
+	exceptExecutedMigrations(sqlMock, testMigrationTable)
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 1, migrations...)
+	err = migrator.Refresh()
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Redo(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// two last executed migrations are rolled back and executed again in the same order
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[2], migrations[1])
+	loggerMock.On("Warn", migrationOutOfOrder, "id", migrations[1].Id)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[1], migrations[2])
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[2], migrations[1])
+	err = migrator.Redo(2)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_SeveralTables(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+
+	const auditTable = "audit.migrations"
+
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations[:2], loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+	expectSchemaTableColumns(sqlMock, auditTable)
+	expectInit(sqlMock, auditTable)
+	auditMigrator, err := createMigrator(migrations[2:], loggerMock, dbClient, auditTable)
+	require.NoError(t, err)
+
+	// table of another schema is found on the next start, missing columns are added
+	expectSchemaTableColumns(sqlMock, auditTable, "id", "migration", "batch", "applied_at", "duration_ms", "checksum", "app_version", "host", "db_user")
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("ALTER TABLE " + quoteTable(auditTable) + " ADD `dirty` boolean NOT NULL DEFAULT false")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.
+		ExpectQuery(regexp.QuoteMeta("select current_user()")).
+		WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow(testDbUser))
+	_, err = createMigrator(migrations[2:], loggerMock, dbClient, auditTable)
+	require.NoError(t, err)
+
+	// every migrator uses its own table
+	exceptExecutedMigrations(sqlMock, testMigrationTable)
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 1, migrations[:2]...)
+	err = migrator.Run()
+	require.NoError(t, err)
+
+	exceptExecutedMigrations(sqlMock, auditTable, migrations[2])
+	expectSuccessExecute(sqlMock, loggerMock, auditTable, 2, migrations[3:]...)
+	err = auditMigrator.Run()
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_RollbackStep_Irreversible(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	migrations[2].Irreversible = true
+	migrations[3].Rollback = nil
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	// migration without rollback handler is flagged in the plan
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations...)
+	expectRollbackCheck(loggerMock, migrations[4])
+	loggerMock.On("Info", migrationWillRollBack, "id", migrations[3].Id, "reason", "executed in batch 1", "irreversible", true)
+	plan, err := migrator.RollbackStepCheck(2)
+	require.Equal(t, ErrIrreversible{Id: migrations[3].Id}, err)
+	require.Equal(t, []bool{false, true}, []bool{plan.Steps[0].Irreversible, plan.Steps[1].Irreversible})
+
+	// nothing is rolled back if any migration is irreversible
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2])
+	err = migrator.RollbackStep(2)
+	require.Equal(t, ErrIrreversible{Id: migrations[2].Id}, err)
+
+	// migrations executed after irreversible one can be rolled back
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2], migrations[4])
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[4])
+	err = migrator.RollbackStep(1)
+	require.NoError(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Run_NoTransaction(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()[:2]
+	migrations[0].NoTransaction = true
+	migrations[1].NoTransaction = true
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	exceptExecutedMigrations(sqlMock, testMigrationTable)
+
+	// migration is marked dirty while it is executed
+	expectDirtyMark(sqlMock, testMigrationTable, 1, migrations[0])
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("execute " + migrations[0].Id)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectClearDirtyMark(sqlMock, testMigrationTable, migrations[0])
+	loggerMock.On("Info", migrationExecuted, "id", migrations[0].Id)
+
+	// failed migration stays dirty
+	expectDirtyMark(sqlMock, testMigrationTable, 1, migrations[1])
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("execute " + migrations[1].Id)).
+		WillReturnError(errors.New("lock wait timeout exceeded"))
+	loggerMock.On("Info", migrationFailed, "id", migrations[1].Id, "err", mock.Anything)
+
+	err = migrator.Run()
+	require.Error(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Dirty(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := createMigrator(migrations, loggerMock, dbClient, testMigrationTable)
+	require.NoError(t, err)
+
+	dirty := executedRecord(migrations[1], 1)
+	dirty.Dirty = true
+
+	// nothing is executed or rolled back while migration is dirty
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), dirty)
+	err = migrator.Run()
+	require.Equal(t, ErrDirty{Id: migrations[1].Id}, err)
+
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), dirty)
+	err = migrator.RollbackStep(1)
+	require.Equal(t, ErrDirty{Id: migrations[1].Id}, err)
+
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), dirty)
+	status, err := migrator.Status()
+	require.NoError(t, err)
+	require.Equal(t, StateDirty, status.Migrations[1].State)
+
+	// migration has been applied by hand
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), dirty)
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("update "+quoteTable(testMigrationTable)+" set dirty = ? where migration = ?")).
+		WithArgs(false, migrations[1].Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	loggerMock.On("Info", migrationForced, "id", migrations[1].Id, "applied", true)
+	err = migrator.Force(migrations[1].Id, true)
+	require.NoError(t, err)
+
+	// migration has been reverted by hand
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), dirty)
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from " + quoteTable(testMigrationTable) + " where migration = ?")).
+		WithArgs(migrations[1].Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	loggerMock.On("Info", migrationForced, "id", migrations[1].Id, "applied", false)
+	err = migrator.Force(migrations[1].Id, false)
+	require.NoError(t, err)
+
+	// migration that has never been executed is marked as executed
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1))
+	expectMarkExecuted(sqlMock, testMigrationTable, 2, migrations[2], false)
+	loggerMock.On("Info", migrationForced, "id", migrations[2].Id, "applied", true)
+	err = migrator.Force(migrations[2].Id, true)
+	require.NoError(t, err)
+
+	err = migrator.Force("unknown", true)
+	require.ErrorAs(t, err, &ErrUnknownMigration{})
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Run_Atomic(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+
+	// mysql has no transactional DDL
+	_, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	_, err = NewMigrator(migrations, Config{Db: dbClient, Logger: loggerMock, Atomic: true})
+	require.ErrorIs(t, err, ErrAtomicNotSupported)
+
+	sqlMock, dbClient, err := createTransactionalDbClient()
+	require.NoError(t, err)
+	expectTransactionalInit(sqlMock, testMigrationTable)
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      testMigrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+		Atomic:     true,
+	})
+	require.NoError(t, err)
+
+	// all migrations are executed in one transaction
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2])
+	sqlMock.ExpectBegin()
+	for _, migration := range migrations[3:] {
+		sqlMock.
+			ExpectExec(regexp.QuoteMeta("execute " + migration.Id)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectMarkExecuted(sqlMock, testMigrationTable, 2, migration, false)
+		loggerMock.On("Info", migrationExecuted, "id", migration.Id)
+	}
+	sqlMock.ExpectCommit()
+	err = migrator.Run()
+	require.NoError(t, err)
+
+	// nothing is applied if any migration fails
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1], migrations[2])
+	sqlMock.ExpectBegin()
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("execute " + migrations[3].Id)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectMarkExecuted(sqlMock, testMigrationTable, 2, migrations[3], false)
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("execute " + migrations[4].Id)).
+		WillReturnError(errors.New("syntax error"))
+	sqlMock.ExpectRollback()
+	loggerMock.On("Info", migrationFailed, "id", migrations[4].Id, "err", mock.Anything)
+	loggerMock.On("Info", atomicRunRolledBack, "ids", []string{migrations[3].Id})
+	err = migrator.Run()
+	require.Error(t, err)
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_Migrator_Run_Compensate(t *testing.T) {
+
+	loggerMock := new(mocks.ILogger)
+
+	migrations := createTestMigrations()
+	migrations[1].Irreversible = true
+	sqlMock, dbClient, err := createDbClient()
+	require.NoError(t, err)
+	expectInit(sqlMock, testMigrationTable)
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      testMigrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+		Compensate: true,
+	})
+	require.NoError(t, err)
+
+	// migrations 2 and 3 are rolled back when migration 4 fails
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[2], migrations[3])
+	expectFailedExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[4])
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[3], migrations[2])
+	err = migrator.Run()
+	var failure ErrRunFailed
+	require.ErrorAs(t, err, &failure)
+	require.Equal(t, migrations[4].Id, failure.Id)
+	require.Equal(t, []string{migrations[3].Id, migrations[2].Id}, failure.RolledBack)
+	require.Nil(t, failure.CompensationFailure)
+	// failed migration can't be undone on mysql, so it is left dirty
+	require.True(t, failure.Dirty)
+	require.Contains(t, failure.Error(), "migration "+migrations[4].Id+" is left dirty, resolve it with Force")
+
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), executedRecord(migrations[1], 1), migration{Migration: migrations[4].Id, Batch: 2, Dirty: true})
+	err = migrator.Run()
+	require.Equal(t, ErrDirty{Id: migrations[4].Id}, err)
+
+	// state of failed migration is resolved
+	exceptExecutedRecords(sqlMock, testMigrationTable, executedRecord(migrations[0], 1), executedRecord(migrations[1], 1), migration{Migration: migrations[4].Id, Batch: 2, Dirty: true})
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("delete from " + quoteTable(testMigrationTable) + " where migration = ?")).
+		WithArgs(migrations[4].Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	loggerMock.On("Info", migrationForced, "id", migrations[4].Id, "applied", false)
+	require.NoError(t, migrator.Force(migrations[4].Id, false))
+
+	// compensation stops on irreversible migration
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[1], migrations[2])
+	expectFailedExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[3])
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[2])
+	loggerMock.On("Info", compensationFailed, "id", migrations[1].Id, "err", ErrIrreversible{Id: migrations[1].Id})
+	err = migrator.Run()
+	require.ErrorAs(t, err, &failure)
+	require.Equal(t, migrations[3].Id, failure.Id)
+	require.Equal(t, []string{migrations[2].Id}, failure.RolledBack)
+	require.Equal(t, migrations[1].Id, failure.CompensationFailure.Id)
+
+	// failed migration is not dirty if it has failed before the dirty mark is set
+	exceptExecutedMigrations(sqlMock, testMigrationTable, migrations[0], migrations[1])
+	expectSuccessExecute(sqlMock, loggerMock, testMigrationTable, 2, migrations[2])
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("insert into " + quoteTable(testMigrationTable))).
+		WillReturnError(errors.New("connection lost"))
+	loggerMock.On("Info", migrationFailed, "id", migrations[3].Id, "err", mock.Anything)
+	expectSuccessRollback(sqlMock, loggerMock, testMigrationTable, migrations[2])
+	err = migrator.Run()
+	require.ErrorAs(t, err, &failure)
+	require.Equal(t, migrations[3].Id, failure.Id)
+	require.Equal(t, []string{migrations[2].Id}, failure.RolledBack)
+	require.False(t, failure.Dirty)
+	require.NotContains(t, failure.Error(), "left dirty")
+
+	loggerMock.AssertExpectations(t)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+// postgresDialector mysql dialector that pretends to be postgres to test dialects with transactional DDL
+type postgresDialector struct {
+	gorm.Dialector
+}
+
+func (postgresDialector) Name() string {
+	return "postgres"
+}
+
 func createDbClient() (sqlmock.Sqlmock, *gorm.DB, error) {
+	return createDbClientWithDialector(func(conn gorm.ConnPool) gorm.Dialector {
+		return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+	})
+}
+
+func createTransactionalDbClient() (sqlmock.Sqlmock, *gorm.DB, error) {
+	return createDbClientWithDialector(func(conn gorm.ConnPool) gorm.Dialector {
+		return postgresDialector{mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})}
+	})
+}
+
+func createDbClientWithDialector(dialector func(conn gorm.ConnPool) gorm.Dialector) (sqlmock.Sqlmock, *gorm.DB, error) {
 	db, sqlMock, err := sqlmock.New()
 	if err != nil {
 		return nil, nil, err
 	}
 
 	gormClient, err := gorm.Open(
-		mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+		dialector(db),
 		&gorm.Config{
 			DisableAutomaticPing: true,
 			Logger: logger.New(
@@ -249,59 +980,153 @@ func createMigrator(
 	dbClient *gorm.DB,
 	migrationTable string,
 ) (IMigrator, error) {
-	migrator, err := NewMigrator(migrations, Config{Db: dbClient, Table: migrationTable, Logger: loggerMock})
+	migrator, err := NewMigrator(migrations, Config{
+		Db:         dbClient,
+		Table:      migrationTable,
+		Logger:     loggerMock,
+		AppVersion: testAppVersion,
+	})
 	return migrator, err
 }
 
 func expectCreateTable(mock sqlmock.Sqlmock, migrationTable string) {
 	mock.
-		ExpectExec(regexp.QuoteMeta("CREATE TABLE `" + migrationTable + "` (`id` smallint unsigned AUTO_INCREMENT NOT NULL,`migration` varchar(191) NOT NULL,PRIMARY KEY (`id`))")).
+		ExpectExec(regexp.QuoteMeta("CREATE TABLE " + quoteTable(migrationTable) + " (`id` smallint unsigned AUTO_INCREMENT NOT NULL,`migration` varchar(191) NOT NULL,`batch` int unsigned NOT NULL DEFAULT 0,`applied_at` datetime(3) NULL,`duration_ms` bigint NOT NULL DEFAULT 0,`checksum` varchar(64) NOT NULL DEFAULT '',`app_version` varchar(191) NOT NULL DEFAULT '',`host` varchar(191) NOT NULL DEFAULT '',`db_user` varchar(191) NOT NULL DEFAULT '',`dirty` boolean NOT NULL DEFAULT false,PRIMARY KEY (`id`),UNIQUE INDEX idx_" + tableName(migrationTable) + "_migration (`migration`))")).
 		WithArgs().
 		WillReturnResult(sqlmock.NewResult(0, 0))
 }
 
+func expectInit(mock sqlmock.Sqlmock, migrationTable string) {
+	expectCreateTable(mock, migrationTable)
+	mock.
+		ExpectQuery(regexp.QuoteMeta("select current_user()")).
+		WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow(testDbUser))
+}
+
+// expect lookup of columns of schema qualified migration table on mysql, no columns means that table doesn't exist
+func expectSchemaTableColumns(mock sqlmock.Sqlmock, migrationTable string, columns ...string) {
+	rows := sqlmock.NewRows([]string{"column_name"})
+	for _, column := range columns {
+		rows.AddRow(column)
+	}
+	schema, table, _ := strings.Cut(migrationTable, ".")
+	mock.
+		ExpectQuery(regexp.QuoteMeta("select column_name from information_schema.columns where table_schema = ? and table_name = ?")).
+		WithArgs(schema, table).
+		WillReturnRows(rows)
+}
+
+func expectTransactionalInit(mock sqlmock.Sqlmock, migrationTable string) {
+	expectCreateTable(mock, migrationTable)
+	mock.
+		ExpectQuery(regexp.QuoteMeta("select current_user")).
+		WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow(testDbUser))
+}
+
 func expectSuccessCheck(loggerMock *mocks.ILogger, migrations ...Migration) {
 	for _, migration := range migrations {
-		loggerMock.On("Info", migrationExecuted, "id", migration.Id)
+		loggerMock.On("Info", migrationWillExecute, "id", migration.Id, "reason", reasonNotExecuted)
 	}
 }
 
 func expectRollbackCheck(loggerMock *mocks.ILogger, migrations ...Migration) {
 	for _, migration := range migrations {
-		loggerMock.On("Info", migrationRolledBack, "id", migration.Id)
+		loggerMock.On("Info", migrationWillRollBack, "id", migration.Id, "reason", "executed in batch 1")
 	}
 }
 
 func exceptExecutedMigrations(mock sqlmock.Sqlmock, migrationTable string, migrations ...Migration) {
-	rows := sqlmock.NewRows([]string{"migration"})
+	var records []migration
 	for _, migration := range migrations {
-		rows.AddRow(migration.Id)
+		records = append(records, executedRecord(migration, 1))
+	}
+	exceptExecutedRecords(mock, migrationTable, records...)
+}
+
+func exceptExecutedRecords(mock sqlmock.Sqlmock, migrationTable string, records ...migration) {
+	rows := sqlmock.NewRows([]string{"id", "migration", "batch", "checksum", "dirty"})
+	for i, record := range records {
+		rows.AddRow(i+1, record.Migration, record.Batch, record.Checksum, record.Dirty)
 	}
 	mock.
-		ExpectQuery(regexp.QuoteMeta("SELECT migration FROM `" + migrationTable + "` ORDER BY id asc")).
+		ExpectQuery(regexp.QuoteMeta("SELECT * FROM " + quoteTable(migrationTable) + " ORDER BY id asc")).
 		WillReturnRows(rows)
 }
 
+func executedRecord(m Migration, batch int) migration {
+	return migration{Migration: m.Id, Batch: batch, Checksum: m.Checksum}
+}
+
 func expectSuccessExecute(
 	mock sqlmock.Sqlmock,
 	logger *mocks.ILogger,
 	migrationTable string,
+	batch int,
 	migrations ...Migration,
 ) {
 	for _, migration := range migrations {
-		mock.ExpectBegin()
-		mock.
-			ExpectExec(regexp.QuoteMeta("execute " + migration.Id)).
-			WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.
-			ExpectExec(regexp.QuoteMeta("insert into " + migrationTable + " (migration) values (?)")).
-			WithArgs(migration.Id).
-			WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectCommit()
+		expectExecute(mock, migrationTable, batch, migration)
 		logger.On("Info", migrationExecuted, "id", migration.Id)
 	}
 }
 
+// mysql has no transactional DDL, so migration is marked dirty outside of transaction
+func expectExecute(mock sqlmock.Sqlmock, migrationTable string, batch int, migration Migration) {
+	expectDirtyMark(mock, migrationTable, batch, migration)
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta("execute " + migration.Id)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectClearDirtyMark(mock, migrationTable, migration)
+	mock.ExpectCommit()
+}
+
+func expectFailedExecute(
+	sqlMock sqlmock.Sqlmock,
+	logger *mocks.ILogger,
+	migrationTable string,
+	batch int,
+	migration Migration,
+) {
+	expectDirtyMark(sqlMock, migrationTable, batch, migration)
+	sqlMock.ExpectBegin()
+	sqlMock.
+		ExpectExec(regexp.QuoteMeta("execute " + migration.Id)).
+		WillReturnError(errors.New("syntax error"))
+	sqlMock.ExpectRollback()
+	logger.On("Info", migrationFailed, "id", migration.Id, "err", mock.Anything)
+}
+
+func expectClearDirtyMark(mock sqlmock.Sqlmock, migrationTable string, migration Migration) {
+	mock.
+		ExpectExec(regexp.QuoteMeta("update "+quoteTable(migrationTable)+" set dirty = ?, duration_ms = ? where migration = ?")).
+		WithArgs(false, sqlmock.AnyArg(), migration.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectDirtyMark(mock sqlmock.Sqlmock, migrationTable string, batch int, migration Migration) {
+	expectMarkExecuted(mock, migrationTable, batch, migration, true)
+}
+
+func expectMarkExecuted(mock sqlmock.Sqlmock, migrationTable string, batch int, migration Migration, dirty bool) {
+	mock.
+		ExpectExec(regexp.QuoteMeta("insert into "+quoteTable(migrationTable)+
+			" (migration, batch, applied_at, duration_ms, checksum, app_version, host, db_user, dirty)"+
+			" values (?, ?, ?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs(
+			migration.Id,
+			batch,
+			sqlmock.AnyArg(),
+			sqlmock.AnyArg(),
+			migration.Checksum,
+			testAppVersion,
+			sqlmock.AnyArg(),
+			testDbUser,
+			dirty,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
 func expectSuccessRollback(
 	mock sqlmock.Sqlmock,
 	logger *mocks.ILogger,
@@ -309,12 +1134,16 @@ func expectSuccessRollback(
 	migrations ...Migration,
 ) {
 	for _, migration := range migrations {
+		mock.
+			ExpectExec(regexp.QuoteMeta("update "+quoteTable(migrationTable)+" set dirty = ? where migration = ?")).
+			WithArgs(true, migration.Id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectBegin()
 		mock.
 			ExpectExec(regexp.QuoteMeta("rollback " + migration.Id)).
 			WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.
-			ExpectExec(regexp.QuoteMeta("delete from " + migrationTable + " where migration = ?")).
+			ExpectExec(regexp.QuoteMeta("delete from " + quoteTable(migrationTable) + " where migration = ?")).
 			WithArgs(migration.Id).
 			WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectCommit()
@@ -322,11 +1151,23 @@ func expectSuccessRollback(
 	}
 }
 
+// quote schema qualified table name the same way as mysql dialect does
+func quoteTable(table string) string {
+	return "`" + strings.ReplaceAll(table, ".", "`.`") + "`"
+}
+
+// get table name without schema
+func tableName(table string) string {
+	parts := strings.Split(table, ".")
+	return parts[len(parts)-1]
+}
+
 func createTestMigrations() []Migration {
 	var migrations []Migration
 	for i := 0; i < 5; i++ {
 		migrations = append(migrations, Migration{
-			Id: "migration_" + strconv.Itoa(i),
+			Id:       "migration_" + strconv.Itoa(i),
+			Checksum: "checksum_" + strconv.Itoa(i),
 			Migrate: func(migrationId int) func(tx *gorm.DB) error {
 				return func(tx *gorm.DB) error {
 					return tx.Exec("execute migration_" + strconv.Itoa(migrationId)).Error
@@ -0,0 +1,123 @@
+package migrator
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	migrationWillExecute  = "migration will be executed"
+	migrationWillRollBack = "migration will be rolled back"
+
+	reasonNotExecuted = "not executed yet"
+)
+
+// Direction of migrations in the plan
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// PlanStep migration that would be executed or rolled back
+type PlanStep struct {
+	Id string
+	// Reason why migration is included in the plan
+	Reason string
+	// Irreversible migration can't be rolled back
+	Irreversible bool
+}
+
+// Plan list of migrations in order they would be executed or rolled back
+type Plan struct {
+	Direction Direction
+	Steps     []PlanStep
+}
+
+// Ids get ids of planned migrations in order of execution
+func (p Plan) Ids() []string {
+	ids := make([]string, 0, len(p.Steps))
+	for _, step := range p.Steps {
+		ids = append(ids, step.Id)
+	}
+	return ids
+}
+
+// Empty check that there is nothing to do
+func (p Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// get error for the first irreversible migration in the plan
+func (p Plan) checkReversible() error {
+	for _, step := range p.Steps {
+		if step.Irreversible {
+			return ErrIrreversible{Id: step.Id}
+		}
+	}
+	return nil
+}
+
+// Log render plan with logger, one record per migration
+func (p Plan) Log(logger ILogger) {
+	if p.Empty() {
+		logger.Info(noAvailableMigrations)
+		return
+	}
+	msg := migrationWillExecute
+	if p.Direction == DirectionDown {
+		msg = migrationWillRollBack
+	}
+	for _, step := range p.Steps {
+		if step.Irreversible {
+			logger.Info(msg, "id", step.Id, "reason", step.Reason, "irreversible", true)
+			continue
+		}
+		logger.Info(msg, "id", step.Id, "reason", step.Reason)
+	}
+}
+
+// String render plan as text, one line per migration
+func (p Plan) String() string {
+	var b strings.Builder
+	for _, step := range p.Steps {
+		b.WriteString(string(p.Direction) + " " + step.Id + " (" + step.Reason + ")")
+		if step.Irreversible {
+			b.WriteString(" irreversible")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// create plan to execute specified quantity of migrations from the list
+func newRunPlan(list []Migration, count int) Plan {
+	plan := Plan{Direction: DirectionUp}
+	for i := 0; i < len(list) && i < count; i++ {
+		plan.Steps = append(plan.Steps, PlanStep{
+			Id:           list[i].Id,
+			Reason:       reasonNotExecuted,
+			Irreversible: !list[i].IsReversible(),
+		})
+	}
+	return plan
+}
+
+// create plan to roll back specified quantity of migrations from the list starting from the last one
+func newRollbackPlan(list []Migration, count int, executed []migration) Plan {
+	batches := make(map[string]int, len(executed))
+	for _, record := range executed {
+		batches[record.Migration] = record.Batch
+	}
+
+	plan := Plan{Direction: DirectionDown}
+	for i := len(list) - 1; i >= 0 && i >= len(list)-count; i-- {
+		plan.Steps = append(plan.Steps, PlanStep{
+			Id:           list[i].Id,
+			Reason:       "executed in batch " + strconv.Itoa(batches[list[i].Id]),
+			Irreversible: !list[i].IsReversible(),
+		})
+	}
+	return plan
+}
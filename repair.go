@@ -0,0 +1,96 @@
+package migrator
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+const (
+	checksumRepaired           = "migration checksum repaired"
+	checksumWillBeRepaired     = "migration checksum will be repaired"
+	checksumRecorded           = "migration checksum recorded"
+	checksumWillBeRecorded     = "migration checksum will be recorded"
+	unknownRecordRemoved       = "unknown migration record removed"
+	unknownRecordWillBeRemoved = "unknown migration record will be removed"
+)
+
+// RepairReport changes of migrations table made or planned by Repair
+type RepairReport struct {
+	// Checksums applied migrations which checksum is replaced with the current one
+	Checksums []ChecksumDrift
+	// Recorded applied migrations executed without checksum, e.g. before checksums were stored,
+	// the current checksum is recorded for them. Applied checksum is empty
+	Recorded []ChecksumDrift
+	// Removed ids of applied migrations that are no longer registered, their records are deleted
+	Removed []string
+}
+
+// Empty check that there is nothing to repair
+func (r RepairReport) Empty() bool {
+	return len(r.Checksums) == 0 && len(r.Recorded) == 0 && len(r.Removed) == 0
+}
+
+func (m *Migrator) Repair(dryRun bool) (RepairReport, error) {
+	return m.RepairContext(context.Background(), dryRun)
+}
+
+func (m *Migrator) RepairContext(ctx context.Context, dryRun bool) (RepairReport, error) {
+	var report RepairReport
+	err := m.withLock(ctx, func() error {
+		executed, err := m.getExecutedMigrationList(ctx)
+		if err != nil {
+			return err
+		}
+
+		report.Checksums = m.getChecksumDrifts(executed)
+		report.Recorded = m.getMissingChecksums(executed)
+		for _, unknown := range m.getStatus(executed).Unknown {
+			report.Removed = append(report.Removed, unknown.Id)
+		}
+		if dryRun {
+			m.logRepair(report, checksumWillBeRepaired, checksumWillBeRecorded, unknownRecordWillBeRemoved)
+			return nil
+		}
+		if report.Empty() {
+			return nil
+		}
+
+		err = m.config.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, drift := range append(report.Checksums, report.Recorded...) {
+				err := tx.Exec("update "+m.quotedTable()+" set checksum = ? where migration = ?", drift.Current, drift.Id).Error
+				if err != nil {
+					return err
+				}
+			}
+			for _, id := range report.Removed {
+				if err := m.removeMigrationExecutedMark(id, tx); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		m.logRepair(report, checksumRepaired, checksumRecorded, unknownRecordRemoved)
+		return nil
+	})
+	if err != nil {
+		return RepairReport{}, err
+	}
+	return report, nil
+}
+
+// log every change of the report
+func (m *Migrator) logRepair(report RepairReport, checksumMsg, recordedMsg, removedMsg string) {
+	for _, drift := range report.Checksums {
+		m.config.Logger.Info(checksumMsg, "id", drift.Id, "applied", drift.Applied, "current", drift.Current)
+	}
+	for _, drift := range report.Recorded {
+		m.config.Logger.Info(recordedMsg, "id", drift.Id, "checksum", drift.Current)
+	}
+	for _, id := range report.Removed {
+		m.config.Logger.Info(removedMsg, "id", id)
+	}
+}
@@ -0,0 +1,265 @@
+package migrator
+
+import (
+	"regexp"
+	"strings"
+)
+
+const defaultDelimiter = ";"
+
+// postgres dollar quote tag, e.g. $$ or $body$
+var dollarTagRegexp = regexp.MustCompile(`^\$([A-Za-z_\x80-\xff][A-Za-z_0-9\x80-\xff]*)?\$`)
+
+// sqlStatement single statement of sql file
+type sqlStatement struct {
+	sql string
+	// line of the file where statement starts
+	line int
+}
+
+// splits sql into statements by delimiter with respect to dialect syntax
+type sqlSplitter struct {
+	dialect   string
+	input     string
+	pos       int
+	line      int
+	delimiter string
+
+	// start of current statement, statement starts at the first token that is not a comment
+	start      int
+	startLine  int
+	inProgress bool
+	statements []sqlStatement
+
+	// first words of current statement, used to detect sqlite CREATE TRIGGER
+	header []string
+	// sqlite trigger body is a BEGIN ... END block with statements inside, CASE ... END may be nested
+	trigger bool
+	depth   int
+}
+
+// split sql into statements, statement delimiters are not included.
+// Delimiters inside quoted strings, identifiers and comments are ignored.
+// MySQL DELIMITER command, Postgres dollar-quoted strings and SQLite trigger bodies are supported.
+func splitStatements(input, dialect string) []sqlStatement {
+	s := &sqlSplitter{dialect: dialect, input: input, line: 1, delimiter: defaultDelimiter}
+	s.split()
+	return s.statements
+}
+
+func (s *sqlSplitter) split() {
+	for s.pos < len(s.input) {
+		rest := s.input[s.pos:]
+		c := rest[0]
+
+		switch {
+		case !s.inProgress && s.dialect == "mysql" && s.isDelimiterCommand(rest):
+			s.changeDelimiter(rest)
+		case strings.HasPrefix(rest, s.delimiter) && s.depth == 0:
+			s.finishStatement()
+			s.advance(len(s.delimiter))
+		case isSpace(c):
+			s.advance(1)
+		case strings.HasPrefix(rest, "--") && (s.dialect != "mysql" || len(rest) == 2 || isSpace(rest[2])),
+			c == '#' && s.dialect == "mysql":
+			s.advance(lineCommentLength(rest))
+		case strings.HasPrefix(rest, "/*"):
+			// mysql executable comment /*! ... */ is a part of statement
+			if s.dialect == "mysql" && strings.HasPrefix(rest, "/*!") {
+				s.startStatement()
+			}
+			s.advance(s.blockCommentLength(rest))
+		case c == '\'':
+			s.startStatement()
+			s.advance(quotedLength(rest, '\'', s.backslashEscapes()))
+		case c == '"':
+			s.startStatement()
+			s.advance(quotedLength(rest, '"', s.dialect == "mysql"))
+		case c == '`' && (s.dialect == "mysql" || s.dialect == "sqlite"):
+			s.startStatement()
+			s.advance(quotedLength(rest, '`', false))
+		case c == '[' && (s.dialect == "sqlserver" || s.dialect == "sqlite"):
+			s.startStatement()
+			s.advance(quotedLength(rest, ']', false))
+		case c == '$' && s.dialect == "postgres" && !s.afterIdentifier():
+			s.startStatement()
+			s.advance(dollarQuotedLength(rest))
+		case s.dialect == "sqlite" && isIdentifierChar(c):
+			s.startStatement()
+			s.advance(s.word(rest))
+		default:
+			s.startStatement()
+			s.advance(1)
+		}
+	}
+	s.finishStatement()
+}
+
+// move position forward, count lines
+func (s *sqlSplitter) advance(n int) {
+	if n > len(s.input)-s.pos {
+		n = len(s.input) - s.pos
+	}
+	s.line += strings.Count(s.input[s.pos:s.pos+n], "\n")
+	s.pos += n
+}
+
+// mark current position as statement start if statement is not started yet
+func (s *sqlSplitter) startStatement() {
+	if s.inProgress {
+		return
+	}
+	s.inProgress = true
+	s.start = s.pos
+	s.startLine = s.line
+}
+
+// add current statement to the list
+func (s *sqlSplitter) finishStatement() {
+	if !s.inProgress {
+		return
+	}
+	s.statements = append(s.statements, sqlStatement{
+		sql:  strings.TrimSpace(s.input[s.start:s.pos]),
+		line: s.startLine,
+	})
+	s.inProgress = false
+	s.header = s.header[:0]
+	s.trigger = false
+	s.depth = 0
+}
+
+// read keyword or identifier, track sqlite trigger body, returns word length
+func (s *sqlSplitter) word(text string) int {
+	length := 1
+	for length < len(text) && isIdentifierChar(text[length]) {
+		length++
+	}
+	word := strings.ToLower(text[:length])
+
+	// CREATE TRIGGER, CREATE TEMP TRIGGER or CREATE TEMPORARY TRIGGER
+	if len(s.header) < 3 {
+		s.header = append(s.header, word)
+		if word == "trigger" && s.header[0] == "create" {
+			s.trigger = true
+		}
+	}
+	if !s.trigger {
+		return length
+	}
+
+	switch word {
+	case "begin", "case":
+		s.depth++
+	case "end":
+		if s.depth > 0 {
+			s.depth--
+		}
+	}
+	return length
+}
+
+// check that text starts with mysql client DELIMITER command
+func (s *sqlSplitter) isDelimiterCommand(text string) bool {
+	const command = "delimiter"
+	return len(text) > len(command) &&
+		strings.EqualFold(text[:len(command)], command) &&
+		(text[len(command)] == ' ' || text[len(command)] == '\t')
+}
+
+// apply DELIMITER command, command takes the rest of the line
+func (s *sqlSplitter) changeDelimiter(text string) {
+	length := lineCommentLength(text)
+	if fields := strings.Fields(text[len("delimiter"):length]); len(fields) > 0 {
+		s.delimiter = fields[0]
+	}
+	s.advance(length)
+}
+
+// string literals support backslash escapes in mysql and postgres E'...' strings
+func (s *sqlSplitter) backslashEscapes() bool {
+	if s.dialect == "mysql" {
+		return true
+	}
+	if s.dialect != "postgres" || s.pos == 0 {
+		return false
+	}
+	prefix := s.input[s.pos-1]
+	return (prefix == 'E' || prefix == 'e') && (s.pos == 1 || !isIdentifierChar(s.input[s.pos-2]))
+}
+
+// check that current position follows identifier, e.g. $ in name like a$b is not a dollar quote
+func (s *sqlSplitter) afterIdentifier() bool {
+	return s.pos > 0 && isIdentifierChar(s.input[s.pos-1])
+}
+
+// length of block comment, postgres supports nested comments
+func (s *sqlSplitter) blockCommentLength(text string) int {
+	depth := 0
+	for i := 0; i < len(text)-1; i++ {
+		switch {
+		case text[i] == '/' && text[i+1] == '*':
+			if depth > 0 && s.dialect != "postgres" {
+				i++
+				continue
+			}
+			depth++
+			i++
+		case text[i] == '*' && text[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(text)
+}
+
+// length of line comment including line break
+func lineCommentLength(text string) int {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return i + 1
+	}
+	return len(text)
+}
+
+// length of text quoted with quote char, doubled closing char is an escape
+func quotedLength(text string, closing byte, backslashEscapes bool) int {
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case closing:
+			if i+1 < len(text) && text[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+// length of postgres dollar-quoted string, $ that is not a quote has length 1
+func dollarQuotedLength(text string) int {
+	tag := dollarTagRegexp.FindString(text)
+	if tag == "" {
+		return 1
+	}
+	if i := strings.Index(text[len(tag):], tag); i >= 0 {
+		return len(tag) + i + len(tag)
+	}
+	return len(text)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
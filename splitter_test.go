@@ -0,0 +1,113 @@
+package migrator
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_splitStatements(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		dialect    string
+		sql        string
+		statements []sqlStatement
+	}{
+		{
+			name:    "statements and comments",
+			dialect: "postgres",
+			sql:     "-- users table\ncreate table users (id int);\n\n/* seed; data */\ninsert into users values (1);  -- first;\ninsert into users values (2)",
+			statements: []sqlStatement{
+				{sql: "create table users (id int)", line: 2},
+				{sql: "insert into users values (1)", line: 5},
+				{sql: "insert into users values (2)", line: 6},
+			},
+		},
+		{
+			name:    "quoted strings and identifiers",
+			dialect: "postgres",
+			sql:     "insert into \"a;b\" values ('it''s; fine', E'\\'; still');\nselect 1;",
+			statements: []sqlStatement{
+				{sql: "insert into \"a;b\" values ('it''s; fine', E'\\'; still')", line: 1},
+				{sql: "select 1", line: 2},
+			},
+		},
+		{
+			name:    "postgres dollar quotes",
+			dialect: "postgres",
+			sql:     "create function f() returns int as $$\nbegin\n  return 1;\nend;\n$$ language plpgsql;\ndo $body$ begin perform 'x;'; end $body$;\nselect $1;",
+			statements: []sqlStatement{
+				{sql: "create function f() returns int as $$\nbegin\n  return 1;\nend;\n$$ language plpgsql", line: 1},
+				{sql: "do $body$ begin perform 'x;'; end $body$", line: 6},
+				{sql: "select $1", line: 7},
+			},
+		},
+		{
+			name:    "postgres nested comments",
+			dialect: "postgres",
+			sql:     "/* outer /* inner; */ still comment; */ select 1;",
+			statements: []sqlStatement{
+				{sql: "select 1", line: 1},
+			},
+		},
+		{
+			name:    "mysql delimiter",
+			dialect: "mysql",
+			sql:     "DELIMITER //\ncreate trigger t before insert on users for each row\nbegin\n  set new.name = 'a;b';\nend//\ndelimiter ;\n# comment;\ninsert into `a;b` values ('\\';');",
+			statements: []sqlStatement{
+				{sql: "create trigger t before insert on users for each row\nbegin\n  set new.name = 'a;b';\nend", line: 2},
+				{sql: "insert into `a;b` values ('\\';')", line: 8},
+			},
+		},
+		{
+			name:    "mysql executable comment",
+			dialect: "mysql",
+			sql:     "/*!40101 SET NAMES utf8 */;\nselect 1--1;",
+			statements: []sqlStatement{
+				{sql: "/*!40101 SET NAMES utf8 */", line: 1},
+				{sql: "select 1--1", line: 2},
+			},
+		},
+		{
+			name:    "sqlite trigger",
+			dialect: "sqlite",
+			sql:     "create table t(id int); create table l(id int);\ncreate trigger tr after insert on t\nwhen new.id > 0\nbegin\n  insert into l values (case when new.id > 1 then 1 else 0 end);\n  insert into l values (new.id);\nend;\ninsert into t values (1);",
+			statements: []sqlStatement{
+				{sql: "create table t(id int)", line: 1},
+				{sql: "create table l(id int)", line: 1},
+				{sql: "create trigger tr after insert on t\nwhen new.id > 0\nbegin\n  insert into l values (case when new.id > 1 then 1 else 0 end);\n  insert into l values (new.id);\nend", line: 2},
+				{sql: "insert into t values (1)", line: 8},
+			},
+		},
+		{
+			name:    "sqlite transaction",
+			dialect: "sqlite",
+			sql:     "begin;\ncreate temp table \"end\" (id int);\ncommit;",
+			statements: []sqlStatement{
+				{sql: "begin", line: 1},
+				{sql: "create temp table \"end\" (id int)", line: 2},
+				{sql: "commit", line: 3},
+			},
+		},
+		{
+			name:    "sqlserver brackets",
+			dialect: "sqlserver",
+			sql:     "select [a;b] from t;",
+			statements: []sqlStatement{
+				{sql: "select [a;b] from t", line: 1},
+			},
+		},
+		{
+			name:       "only comments",
+			dialect:    "sqlite",
+			sql:        "-- nothing here;\n/* ; */\n;",
+			statements: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.statements, splitStatements(test.sql, test.dialect))
+		})
+	}
+}
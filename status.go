@@ -0,0 +1,97 @@
+package migrator
+
+import "time"
+
+// State of registered migration
+type State string
+
+const (
+	StatePending State = "pending"
+	StateApplied State = "applied"
+	// StateOutOfOrder migration is applied after a migration that is declared later than it
+	StateOutOfOrder State = "applied out of order"
+	// StateDirty migration is being executed or rolled back without transaction, or has failed halfway
+	StateDirty State = "dirty"
+)
+
+// AppliedMigration execution metadata stored in migrations table
+type AppliedMigration struct {
+	Id         string
+	Batch      int
+	AppliedAt  time.Time
+	Duration   time.Duration
+	Checksum   string
+	AppVersion string
+	Host       string
+	DbUser     string
+	// Dirty migration is being executed or rolled back without transaction, or has failed halfway
+	Dirty bool
+}
+
+// MigrationStatus state of registered migration
+type MigrationStatus struct {
+	Id    string
+	State State
+	// Applied execution metadata, nil if migration is pending
+	Applied *AppliedMigration
+}
+
+// Status state of all migrations
+type Status struct {
+	// Migrations registered migrations in declared order
+	Migrations []MigrationStatus
+	// Unknown migrations that are applied, but no longer registered, in order of execution
+	Unknown []AppliedMigration
+}
+
+// convert migrations table record to execution metadata
+func newAppliedMigration(record migration) AppliedMigration {
+	applied := AppliedMigration{
+		Id:         record.Migration,
+		Batch:      record.Batch,
+		Duration:   time.Duration(record.Duration) * time.Millisecond,
+		Checksum:   record.Checksum,
+		AppVersion: record.AppVersion,
+		Host:       record.Host,
+		DbUser:     record.DbUser,
+		Dirty:      record.Dirty,
+	}
+	if record.AppliedAt != nil {
+		applied.AppliedAt = *record.AppliedAt
+	}
+	return applied
+}
+
+// compare registered migrations with executed ones
+func (m *Migrator) getStatus(executed []migration) Status {
+	records := make(map[string]migration, len(executed))
+	for _, record := range executed {
+		records[record.Migration] = record
+	}
+	outOfOrder := m.getOutOfOrderMigrations(executed)
+
+	var status Status
+	for _, migration := range m.migrations {
+		record, ok := records[migration.Id]
+		if !ok {
+			status.Migrations = append(status.Migrations, MigrationStatus{Id: migration.Id, State: StatePending})
+			continue
+		}
+		applied := newAppliedMigration(record)
+		state := StateApplied
+		if record.Dirty {
+			state = StateDirty
+		} else if Contains(outOfOrder, migration.Id) {
+			state = StateOutOfOrder
+		}
+		status.Migrations = append(status.Migrations, MigrationStatus{Id: migration.Id, State: state, Applied: &applied})
+	}
+
+	for _, record := range executed {
+		if m.getMigrationIndex(record.Migration) < 0 {
+			status.Unknown = append(status.Unknown, newAppliedMigration(record))
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,81 @@
+package migrator
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// maximum length of migration id, limited by migrations table column size
+const maxMigrationIdLength = 191
+
+// IdPolicy checks migration id naming, returns error describing the violation
+type IdPolicy func(id string) error
+
+// IdPattern policy requires migration id to match the regular expression
+func IdPattern(pattern *regexp.Regexp) IdPolicy {
+	return func(id string) error {
+		if !pattern.MatchString(id) {
+			return errors.New("id does not match pattern " + pattern.String())
+		}
+		return nil
+	}
+}
+
+// TimestampPrefix policy requires migration id to start with timestamp in the layout followed by underscore.
+// For example, TimestampPrefix("20060102150405") accepts id 20220314120000_create_users_table
+func TimestampPrefix(layout string) IdPolicy {
+	return func(id string) error {
+		if len(id) <= len(layout) || id[len(layout)] != '_' {
+			return errors.New("id does not start with timestamp " + layout + " followed by underscore")
+		}
+		_, err := time.Parse(layout, id[:len(layout)])
+		if err != nil {
+			return errors.New("id does not start with valid timestamp " + layout)
+		}
+		return nil
+	}
+}
+
+// ValidateMigrations check that every migration has unique non-empty id that fits migrations table
+// and satisfies the policy, has migrate handler and its files are read. Policy is not checked, if nil.
+// Returns ErrInvalidMigrations with every found problem.
+func ValidateMigrations(migrations []Migration, policy IdPolicy) error {
+	var problems []string
+	seen := make(map[string]bool, len(migrations))
+
+	for i, migration := range migrations {
+		name := "migration " + migration.Id
+		if migration.Id == "" {
+			name = "migration #" + strconv.Itoa(i+1)
+			problems = append(problems, name+": id is empty")
+		} else {
+			if seen[migration.Id] {
+				problems = append(problems, name+": id is duplicated")
+			}
+			seen[migration.Id] = true
+
+			if utf8.RuneCountInString(migration.Id) > maxMigrationIdLength {
+				problems = append(problems, name+": id is longer than "+strconv.Itoa(maxMigrationIdLength)+" characters")
+			}
+			if policy != nil {
+				if err := policy(migration.Id); err != nil {
+					problems = append(problems, name+": "+err.Error())
+				}
+			}
+		}
+		if migration.Migrate == nil {
+			problems = append(problems, name+": migrate handler is nil")
+		}
+		if migration.loadErr != nil {
+			problems = append(problems, name+": "+migration.loadErr.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return ErrInvalidMigrations{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package migrator
+
+import (
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_ValidateMigrations(t *testing.T) {
+
+	migrations := createTestMigrations()
+	require.NoError(t, ValidateMigrations(migrations, nil))
+
+	// id length is limited in characters, not bytes
+	nonAscii := Migration{Id: strings.Repeat("я", maxMigrationIdLength), Migrate: migrations[0].Migrate}
+	require.NoError(t, ValidateMigrations([]Migration{nonAscii}, nil))
+
+	migrations = append(
+		migrations,
+		Migration{Id: "", Migrate: migrations[0].Migrate},
+		Migration{Id: migrations[1].Id, Migrate: migrations[1].Migrate},
+		Migration{Id: strings.Repeat("a", maxMigrationIdLength+1), Migrate: migrations[2].Migrate},
+		Migration{Id: "no_handler"},
+	)
+
+	err := ValidateMigrations(migrations, nil)
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Equal(t, []string{
+		"migration #6: id is empty",
+		"migration migration_1: id is duplicated",
+		"migration " + migrations[7].Id + ": id is longer than 191 characters",
+		"migration no_handler: migrate handler is nil",
+	}, err.(ErrInvalidMigrations).Problems)
+}
+
+func Test_ValidateMigrations_Policy(t *testing.T) {
+
+	handler := func(tx *gorm.DB) error { return nil }
+	migrations := []Migration{
+		{Id: "20220314120000_create_users_table", Migrate: handler},
+		{Id: "20221314120000_create_posts_table", Migrate: handler},
+		{Id: "create_comments_table", Migrate: handler},
+	}
+
+	err := ValidateMigrations(migrations, TimestampPrefix("20060102150405"))
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Len(t, err.(ErrInvalidMigrations).Problems, 2)
+
+	err = ValidateMigrations(migrations, IdPattern(regexp.MustCompile(`^\d{14}_[a-z_]+$`)))
+	require.ErrorAs(t, err, &ErrInvalidMigrations{})
+	require.Equal(t, []string{
+		`migration create_comments_table: id does not match pattern ^\d{14}_[a-z_]+$`,
+	}, err.(ErrInvalidMigrations).Problems)
+}